@@ -0,0 +1,461 @@
+package martini
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultMaxMemory is how much of a multipart body is kept in memory, the rest of the files go to disk.
+const defaultMaxMemory = 32 << 20
+
+// BindingError is a value of the request that couldn't be bound, or that failed a validation rule.
+type BindingError struct {
+	// Field is the name of the field the value is bound by, empty for errors about the whole body.
+	Field string
+	// Rule is the validation rule that failed, "type" for values that don't fit the field and "body" for
+	// bodies that can't be decoded. Bodies cut off by BodyLimit are "size" and "slow" errors.
+	Rule    string
+	Message string
+}
+
+// BindingErrors is mapped by Bind along with the struct. It is empty if the request was bound and is valid.
+// It is an HTTPError, so handlers can return it to answer with 422, or 400 if the body couldn't be decoded
+// and 413 or 408 if BodyLimit cut it off.
+type BindingErrors []BindingError
+
+func (errs BindingErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (errs BindingErrors) StatusCode() int {
+	for _, e := range errs {
+		switch e.Rule {
+		case "body":
+			return http.StatusBadRequest
+		case "size":
+			return http.StatusRequestEntityTooLarge
+		case "slow":
+			return http.StatusRequestTimeout
+		}
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// Has reports whether there is an error for the field.
+func (errs BindingErrors) Has(field string) bool {
+	for _, e := range errs {
+		if e.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Bind returns a handler that binds the request to a new struct of the type of obj and maps it, along with
+// the BindingErrors. If obj is a pointer, the pointer to the struct is mapped.
+//
+// JSON and XML bodies are decoded with encoding/json and encoding/xml. Query values, urlencoded and multipart
+// forms are bound to the fields by their form tag, their json tag or their name, repeated values fill slices
+// and files fill *multipart.FileHeader fields. Fields with a param tag get the route's Params, whatever the
+// body says.
+//
+// Values of a form body win over the ones of the query, which only fill the fields the body has no values for.
+// Requests with a JSON or XML body are bound from the body alone, so the query can't override it. The validate
+// tag lists the rules the field has to pass:
+//
+//	type Signup struct {
+//		Team  string   `param:"team"`
+//		Name  string   `form:"name" validate:"required,min=3,max=20"`
+//		Email string   `form:"email" validate:"required,email"`
+//		Tags  []string `form:"tag" validate:"max=5"`
+//		Code  string   `form:"code" validate:"regex=^[A-Z]{4}$"`
+//	}
+//
+//	m.Post("/teams/:team/signups", martini.Bind(Signup{}), func(s Signup, errs martini.BindingErrors) error {
+//		if len(errs) > 0 {
+//			return errs
+//		}
+//		...
+//	})
+//
+// min and max bound numbers, and the length of strings and slices. regex has to be the last rule.
+// Other rules than required are only checked for values that aren't empty. Bind panics if the tags are invalid.
+func Bind(obj interface{}) Handler {
+	t := reflect.TypeOf(obj)
+	ptr := t.Kind() == reflect.Ptr
+	if ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		panic("martini: Bind needs a struct, got " + t.String())
+	}
+	fields := bindingFields(t, nil, "", true)
+
+	return func(c Context, req *http.Request) {
+		var params Params
+		if p := c.Get(reflect.TypeOf(params)); p.IsValid() {
+			params = p.Interface().(Params)
+		}
+		v := reflect.New(t)
+		errs := bindRequest(req, params, v, fields)
+		for _, f := range fields {
+			errs = append(errs, f.validate(v.Elem().FieldByIndex(f.index))...)
+		}
+
+		if ptr {
+			c.Map(v.Interface())
+		} else {
+			c.Map(v.Elem().Interface())
+		}
+		c.Map(errs)
+	}
+}
+
+// bindRequest decodes the body into v and sets the fields from the form values and the params, see Bind for
+// the precedence.
+func bindRequest(req *http.Request, params Params, v reflect.Value, fields []bindingField) BindingErrors {
+	var errs BindingErrors
+	body := req.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get(ContentType))
+	// the values of forms and queries, nil for JSON and XML bodies
+	var values url.Values
+	switch {
+	case mediaType == ContentJSON || strings.HasSuffix(mediaType, "+json"):
+		if err := json.NewDecoder(body).Decode(v.Interface()); err != nil && err != io.EOF {
+			if e, ok := err.(*json.UnmarshalTypeError); ok {
+				errs = append(errs, BindingError{e.Field, "type", fmt.Sprintf("%s must be a %s", e.Field, e.Type)})
+			} else {
+				errs = append(errs, bodyError("the body isn't valid JSON: ", err))
+			}
+		}
+	case mediaType == ContentXML || mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml"):
+		if err := xml.NewDecoder(body).Decode(v.Interface()); err != nil && err != io.EOF {
+			errs = append(errs, bodyError("the body isn't valid XML: ", err))
+		}
+	default:
+		if mediaType == "multipart/form-data" {
+			if err := req.ParseMultipartForm(defaultMaxMemory); err != nil {
+				errs = append(errs, bodyError("the body isn't a valid multipart form: ", err))
+			}
+		} else if req.Form == nil {
+			// a urlencoded body
+			if err := req.ParseForm(); err != nil {
+				errs = append(errs, bodyError("the form is invalid: ", err))
+			}
+		}
+		// the values of the body replace the ones of the query
+		values = req.URL.Query()
+		for k, v := range req.PostForm {
+			values[k] = v
+		}
+	}
+
+	for _, f := range fields {
+		field := v.Elem().FieldByIndex(f.index)
+		var err error
+		switch {
+		case f.param != "":
+			if value, ok := params[f.param]; ok {
+				err = setValue(field, value)
+			}
+		case !f.form || values == nil:
+		case field.Type() == fileHeaderType || field.Type() == fileHeadersType:
+			if req.MultipartForm != nil && len(req.MultipartForm.File[f.name]) > 0 {
+				files := req.MultipartForm.File[f.name]
+				if field.Type() == fileHeaderType {
+					field.Set(reflect.ValueOf(files[0]))
+				} else {
+					field.Set(reflect.ValueOf(files))
+				}
+			}
+		default:
+			if vs, ok := values[f.name]; ok {
+				err = setValues(field, vs)
+			}
+		}
+		if err != nil {
+			errs = append(errs, BindingError{f.name, "type", fmt.Sprintf("%s has an invalid value: %v", f.name, err)})
+		}
+	}
+	return errs
+}
+
+// bodyError describes an error of reading the body. The errors of BodyLimit keep their status code.
+func bodyError(message string, err error) BindingError {
+	var httpErr HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode() {
+		case http.StatusRequestEntityTooLarge:
+			return BindingError{"", "size", httpErr.Error()}
+		case http.StatusRequestTimeout:
+			return BindingError{"", "slow", httpErr.Error()}
+		}
+	}
+	return BindingError{"", "body", message + err.Error()}
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType     = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+// bindingField is a field of the struct Bind binds, with the rules of its validate tag.
+type bindingField struct {
+	index []int
+	name  string
+	param string
+	// form is false for fields of nested structs, which aren't bound from form values
+	form     bool
+	required bool
+	min, max *float64
+	pattern  *regexp.Regexp
+	email    bool
+}
+
+// bindingFields returns the exported fields of the struct type, the ones of embedded structs included.
+// The fields of nested structs are named after the struct field, like "Address.City".
+func bindingFields(t reflect.Type, index []int, prefix string, form bool) []bindingField {
+	var fields []bindingField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		name := fieldName(f)
+		if name == "-" {
+			continue
+		}
+		idx := append(append([]int(nil), index...), i)
+
+		if f.Type.Kind() == reflect.Struct && !reflect.PtrTo(f.Type).Implements(textUnmarshalerType) {
+			if f.Anonymous {
+				fields = append(fields, bindingFields(f.Type, idx, prefix, form)...)
+			} else {
+				fields = append(fields, bindingFields(f.Type, idx, prefix+name+".", false)...)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		bf := bindingField{index: idx, name: prefix + name, param: f.Tag.Get("param"), form: form}
+		if err := bf.parseRules(f.Tag.Get("validate")); err != nil {
+			panic(fmt.Sprintf("martini: invalid validate tag of %s.%s: %v", t, f.Name, err))
+		}
+		fields = append(fields, bf)
+	}
+	return fields
+}
+
+// fieldName returns the form tag of the field, its json tag or its name.
+func fieldName(f reflect.StructField) string {
+	for _, tag := range []string{"form", "json"} {
+		if name := strings.Split(f.Tag.Get(tag), ",")[0]; name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func (f *bindingField) parseRules(tag string) error {
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regex=") {
+			rule, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "required":
+			f.required = true
+		case "email":
+			f.email = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return fmt.Errorf("%s needs a number", name)
+			}
+			if name == "min" {
+				f.min = &n
+			} else {
+				f.max = &n
+			}
+		case "regex":
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return err
+			}
+			f.pattern = re
+		default:
+			return fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	return nil
+}
+
+// validate checks the value of the field against its rules.
+func (f *bindingField) validate(v reflect.Value) []BindingError {
+	if isEmpty(v) {
+		if f.required {
+			return []BindingError{{f.name, "required", f.name + " is required"}}
+		}
+		return nil
+	}
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	var errs []BindingError
+	size, unit := 0.0, ""
+	switch v.Kind() {
+	case reflect.String:
+		size, unit = float64(utf8.RuneCountInString(v.String())), " characters long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size, unit = float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = v.Float()
+	}
+	if f.min != nil && size < *f.min {
+		errs = append(errs, BindingError{f.name, "min", fmt.Sprintf("%s must be at least %s%s", f.name, formatFloat(*f.min), unit)})
+	}
+	if f.max != nil && size > *f.max {
+		errs = append(errs, BindingError{f.name, "max", fmt.Sprintf("%s must be at most %s%s", f.name, formatFloat(*f.max), unit)})
+	}
+
+	if v.Kind() == reflect.String {
+		s := v.String()
+		if f.pattern != nil && !f.pattern.MatchString(s) {
+			errs = append(errs, BindingError{f.name, "regex", fmt.Sprintf("%s must match %s", f.name, f.pattern)})
+		}
+		if f.email {
+			if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+				errs = append(errs, BindingError{f.name, "email", f.name + " must be an email address"})
+			}
+		}
+	}
+	return errs
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// setValues sets the field to the form values, all of them for slices and the first one otherwise.
+func setValues(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && !isByteSlice(v) && !reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(s.Index(i), value); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setValue(v, values[0])
+}
+
+// setValue converts the string to the type of the field and sets it. Empty strings leave numbers at zero.
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	case reflect.Slice:
+		if isByteSlice(v) {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+	}
+	if s == "" {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if s == "on" {
+			// checkboxes
+			s = "true"
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q isn't a boolean", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q isn't an integer", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q isn't a positive integer", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q isn't a number", s)
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("can't bind to a %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package martini
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type Audit struct {
+	Source string `form:"source"`
+}
+
+type signup struct {
+	Audit
+	Team    string   `param:"team"`
+	Name    string   `form:"name" json:"name" validate:"required,min=3,max=10"`
+	Email   string   `form:"email" json:"email" validate:"required,email"`
+	Age     int      `form:"age" json:"age" validate:"min=18"`
+	Tags    []string `form:"tag" json:"tags" validate:"max=2"`
+	Code    string   `form:"code" json:"code" validate:"regex=^[A-Z]{2,4}$"`
+	Agree   *bool    `form:"agree" json:"agree"`
+	Address struct {
+		City string `validate:"required"`
+	} `json:"address"`
+}
+
+func bindServer(result *signup, errs *BindingErrors) *ClassicMartini {
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Post("/teams/:team", Bind(signup{}), func(s signup, e BindingErrors) {
+		*result, *errs = s, e
+	})
+	m.Put("/teams/:team", Bind(&signup{}), func(s *signup, e BindingErrors) error {
+		if len(e) > 0 {
+			return e
+		}
+		return nil
+	})
+	return m
+}
+
+func Test_BindForm(t *testing.T) {
+	var s signup
+	var errs BindingErrors
+	m := bindServer(&s, &errs)
+
+	form := url.Values{
+		"name": {"jeremy"}, "email": {"jeremy@example.com"}, "age": {"30"}, "tag": {"go", "web"},
+		"code": {"GO"}, "agree": {"on"},
+	}
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/teams/gophers?source=ad", strings.NewReader(form.Encode()))
+	req.Header.Set(ContentType, "application/x-www-form-urlencoded")
+	m.ServeHTTP(res, req)
+
+	expect(t, len(errs), 1)
+	expect(t, errs[0].Field, "address.City")
+	expect(t, errs[0].Rule, "required")
+	expect(t, s.Team, "gophers")
+	expect(t, s.Source, "ad")
+	expect(t, s.Name, "jeremy")
+	expect(t, s.Age, 30)
+	expectDeep(t, s.Tags, []string{"go", "web"})
+	expect(t, *s.Agree, true)
+}
+
+func Test_BindJSON(t *testing.T) {
+	var s signup
+	var errs BindingErrors
+	m := bindServer(&s, &errs)
+
+	body := `{"name": "jo", "email": "not an email", "age": 12, "tags": ["a", "b", "c"], "code": "go",
+		"address": {"City": "Berlin"}}`
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/teams/gophers?source=ad", strings.NewReader(body))
+	req.Header.Set(ContentType, "application/json")
+	m.ServeHTTP(res, req)
+
+	expect(t, s.Address.City, "Berlin")
+	// the query isn't bound for JSON bodies
+	expect(t, s.Source, "")
+	expectDeep(t, errs, BindingErrors{
+		{"name", "min", "name must be at least 3 characters long"},
+		{"email", "email", "email must be an email address"},
+		{"age", "min", "age must be at least 18"},
+		{"tag", "max", "tag must be at most 2 items"},
+		{"code", "regex", "code must match ^[A-Z]{2,4}$"},
+	})
+	expect(t, errs.Has("email"), true)
+	expect(t, errs.Has("team"), false)
+}
+
+func Test_BindPrecedence(t *testing.T) {
+	type user struct {
+		Team string `param:"team" form:"team"`
+		Role string `form:"role" json:"role" xml:"role"`
+		Name string `form:"name" json:"name" xml:"name"`
+	}
+	var u user
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Post("/teams/:team", Bind(user{}), func(b user) {
+		u = b
+	})
+
+	var multipartBody bytes.Buffer
+	w := multipart.NewWriter(&multipartBody)
+	w.WriteField("role", "user")
+	w.WriteField("team", "body")
+	w.Close()
+
+	for _, tt := range []struct {
+		contentType, body string
+		role, name        string
+	}{
+		{"application/json", `{"role": "user", "team": "body"}`, "user", ""},
+		{"application/xml", "<user><role>user</role></user>", "user", ""},
+		{"application/x-www-form-urlencoded", "role=user&team=body", "user", "query"},
+		{w.FormDataContentType(), multipartBody.String(), "user", "query"},
+		{"", "", "admin", "query"},
+	} {
+		u = user{}
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/teams/gophers?role=admin&name=query&team=query", strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set(ContentType, tt.contentType)
+		}
+		m.ServeHTTP(res, req)
+		expect(t, u.Team, "gophers")
+		expect(t, u.Role, tt.role)
+		expect(t, u.Name, tt.name)
+	}
+}
+
+func Test_BindErrors(t *testing.T) {
+	var s signup
+	var errs BindingErrors
+	m := bindServer(&s, &errs)
+
+	for _, tt := range []struct {
+		method, contentType, body string
+		code                      int
+		message                   string
+	}{
+		{"PUT", "application/json", `{"name": `, http.StatusBadRequest, "the body isn't valid JSON"},
+		{"PUT", "application/json", `{"age": "old"}`, http.StatusUnprocessableEntity, "age must be a int"},
+		{"PUT", "application/x-www-form-urlencoded", "age=old", http.StatusUnprocessableEntity, "age has an invalid value"},
+		{"PUT", "application/json", `{"name": "jeremy", "email": "j@example.com", "address": {"City": "Berlin"}}`, http.StatusOK, ""},
+	} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, "/teams/gophers", strings.NewReader(tt.body))
+		req.Header.Set(ContentType, tt.contentType)
+		req.Header.Set("Accept", "application/json")
+		m.ServeHTTP(res, req)
+		expect(t, res.Code, tt.code)
+		if !strings.Contains(res.Body.String(), tt.message) {
+			t.Errorf("%s: expected %q in %q", tt.body, tt.message, res.Body.String())
+		}
+	}
+}
+
+func Test_BindMultipart(t *testing.T) {
+	type upload struct {
+		Title string                  `form:"title"`
+		File  *multipart.FileHeader   `form:"file" validate:"required"`
+		More  []*multipart.FileHeader `form:"more"`
+	}
+	var u upload
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Post("/upload", Bind(upload{}), func(b upload, errs BindingErrors) {
+		expect(t, len(errs), 0)
+		u = b
+	})
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("title", "report")
+	f, _ := w.CreateFormFile("file", "report.txt")
+	f.Write([]byte("hello"))
+	w.Close()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/upload", &body)
+	req.Header.Set(ContentType, w.FormDataContentType())
+	m.ServeHTTP(res, req)
+	expect(t, u.Title, "report")
+	expect(t, u.File.Filename, "report.txt")
+	expect(t, len(u.More), 0)
+}
+
+func Test_BindInvalidTags(t *testing.T) {
+	defer func() {
+		refute(t, recover(), nil)
+	}()
+	Bind(struct {
+		Name string `validate:"min=three"`
+	}{})
+}
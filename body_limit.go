@@ -0,0 +1,228 @@
+package martini
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/insionng/martini/inject"
+)
+
+// BodyLimitMeta is the route metadata key that sets the body limit of a route, overriding the one of a
+// BodyLimit middleware added with Use:
+//
+//	m.Post("/uploads", handler).Meta(martini.BodyLimitMeta, int64(100<<20))
+const BodyLimitMeta = "bodyLimit"
+
+// BodyLimitOptions is a struct for specifying configuration options for the martini.BodyLimit middleware.
+type BodyLimitOptions struct {
+	// MinRate is the slowest a body may be sent, in bytes per second on average. Bodies that are sent slower
+	// are cut off with 408. Defaults to 1024, a negative rate turns the check off.
+	MinRate int64
+	// Grace is how long a body may be sent slower than MinRate at first. Defaults to 5 seconds.
+	Grace time.Duration
+}
+
+func prepareBodyLimitOptions(options []BodyLimitOptions) BodyLimitOptions {
+	var opt BodyLimitOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	// Defaults
+	if opt.MinRate == 0 {
+		opt.MinRate = 1024
+	}
+	if opt.Grace == 0 {
+		opt.Grace = 5 * time.Second
+	}
+	return opt
+}
+
+// BodyLimit returns a middleware handler that limits the request body to limit bytes, a limit of 0 or less
+// turns it off. Reading a larger body fails, and the request is answered with 413 through the ErrorHandler if
+// the handlers didn't write a response. Bodies sent slower than the MinRate are cut off the same way with 408.
+//
+// Add it with Use to limit every request, or pass it to Classic, which has to be done for the limit to apply
+// to the form bodies ContextRender parses. Added to a route, it replaces the limit and options of the one added
+// with Use, as does the BodyLimitMeta of the route. Limits of a route only apply to bodies that are read after
+// routing, a body read by ContextRender or other middleware before it is limited by the BodyLimit added first.
+//
+// The read deadlines BodyLimit sets to enforce the MinRate don't go past the ReadTimeout of the http.Server, and
+// that deadline is put back once the handlers return.
+func BodyLimit(limit int64, options ...BodyLimitOptions) Handler {
+	opt := prepareBodyLimitOptions(options)
+	return func(c Context, res http.ResponseWriter, req *http.Request) {
+		if b, ok := req.Body.(*limitedBody); ok {
+			b.limit, b.opt, b.overridden = limit, opt, true
+			if b.err == nil && limit > 0 && b.read > limit {
+				// middleware before the route read more already
+				b.err = b.tooLarge()
+			}
+			c.Next()
+			return
+		}
+		if req.Body == nil || req.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		b := &limitedBody{
+			body:           req.Body,
+			limit:          limit,
+			opt:            opt,
+			c:              c,
+			rc:             http.NewResponseController(res),
+			contentLength:  req.ContentLength,
+			serverDeadline: serverReadDeadline(req),
+		}
+		req.Body = b
+		c.Next()
+		b.restoreDeadline()
+
+		if b.err == nil {
+			return
+		}
+		if rw, ok := res.(ResponseWriter); ok && rw.Written() {
+			return
+		}
+		if b.err.StatusCode() == http.StatusRequestTimeout {
+			res.Header().Set("Connection", "close")
+		}
+		handleError(c, b.err)
+	}
+}
+
+// limitedBody is the request body of BodyLimit. The limit of the route is looked up when it is first read,
+// the route isn't known before.
+type limitedBody struct {
+	body           io.ReadCloser
+	limit          int64
+	opt            BodyLimitOptions
+	overridden     bool
+	c              Context
+	rc             *http.ResponseController
+	contentLength  int64
+	serverDeadline time.Time
+
+	started    bool
+	start      time.Time
+	read       int64
+	eof        bool
+	noDeadline bool
+	deadline   bool
+	err        HTTPError
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if !b.started {
+		b.begin()
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.eof {
+		return 0, io.EOF
+	}
+
+	if b.limit > 0 && b.read > b.limit {
+		b.err = b.tooLarge()
+		return 0, b.err
+	}
+	if b.limit > 0 && int64(len(p)) > b.limit-b.read+1 {
+		// read a byte more than allowed to find out if the body is too large
+		p = p[:b.limit-b.read+1]
+	}
+	b.setDeadline()
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+
+	if b.limit > 0 && b.read > b.limit {
+		n -= int(b.read - b.limit)
+		b.read = b.limit
+		b.err = b.tooLarge()
+		return n, b.err
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) || b.noDeadline && b.tooSlow() {
+		b.err = NewHTTPError(http.StatusRequestTimeout, "the request body was sent too slowly")
+		return n, b.err
+	}
+	if err == io.EOF {
+		// the server reads the connection in the background now
+		b.eof = true
+		b.restoreDeadline()
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// begin looks up the limit of the route and checks the Content-Length against it.
+func (b *limitedBody) begin() {
+	b.started, b.start = true, time.Now()
+	if !b.overridden {
+		if v := b.c.Get(inject.InterfaceOf((*Route)(nil))); v.IsValid() {
+			switch limit := v.Interface().(Route).GetMeta(BodyLimitMeta).(type) {
+			case int:
+				b.limit = int64(limit)
+			case int64:
+				b.limit = limit
+			}
+		}
+	}
+	if b.limit > 0 && b.contentLength > b.limit {
+		b.err = b.tooLarge()
+	}
+}
+
+func (b *limitedBody) tooLarge() HTTPError {
+	return NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("the request body is larger than %d bytes", b.limit))
+}
+
+// setDeadline makes the next read fail once the body falls behind the MinRate.
+func (b *limitedBody) setDeadline() {
+	if b.opt.MinRate < 0 || b.noDeadline {
+		return
+	}
+	wait := time.Duration(b.read) * time.Second / time.Duration(b.opt.MinRate)
+	if wait < b.opt.Grace {
+		wait = b.opt.Grace
+	}
+	deadline := b.start.Add(wait)
+	if !b.serverDeadline.IsZero() && deadline.After(b.serverDeadline) {
+		deadline = b.serverDeadline
+	}
+	if err := b.rc.SetReadDeadline(deadline); err != nil {
+		// check the rate after reading instead
+		b.noDeadline = true
+		return
+	}
+	b.deadline = true
+}
+
+// restoreDeadline puts the deadline of the server back, for the rest of the body the server reads.
+func (b *limitedBody) restoreDeadline() {
+	if b.deadline {
+		b.rc.SetReadDeadline(b.serverDeadline)
+		b.deadline = false
+	}
+}
+
+// serverReadDeadline returns about when the ReadTimeout of the server that received the request runs out, or
+// zero if there is none. The server starts the timeout before it reads the headers, a little before this.
+func serverReadDeadline(req *http.Request) time.Time {
+	if srv, ok := req.Context().Value(http.ServerContextKey).(*http.Server); ok && srv.ReadTimeout > 0 {
+		return time.Now().Add(srv.ReadTimeout)
+	}
+	return time.Time{}
+}
+
+func (b *limitedBody) tooSlow() bool {
+	elapsed := time.Since(b.start)
+	return b.opt.MinRate > 0 && elapsed > b.opt.Grace && float64(b.read) < float64(b.opt.MinRate)*elapsed.Seconds()
+}
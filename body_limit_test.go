@@ -0,0 +1,162 @@
+package martini
+
+import (
+	"bufio"
+	gocontext "context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func bodyLimitServer() *ClassicMartini {
+	m := Classic(BodyLimit(10))
+	m.Map(log.New(ioutil.Discard, "", 0))
+	read := func(res http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err == nil {
+			res.Write(body)
+		}
+	}
+	m.Post("/", read)
+	m.Post("/meta", read).Meta(BodyLimitMeta, 20)
+	m.Post("/route", BodyLimit(30), read)
+	m.Post("/unlimited", BodyLimit(0), read)
+	m.Post("/bind", Bind(struct {
+		Name string `json:"name"`
+	}{}), func(errs BindingErrors) error {
+		if len(errs) > 0 {
+			return errs
+		}
+		return nil
+	})
+	return m
+}
+
+func Test_BodyLimit(t *testing.T) {
+	m := bodyLimitServer()
+	for _, tt := range []struct {
+		path          string
+		contentType   string
+		size          int
+		contentLength bool
+		code          int
+	}{
+		{"/", ContentJSON, 10, true, http.StatusOK},
+		{"/", ContentJSON, 11, true, http.StatusRequestEntityTooLarge},
+		{"/", ContentJSON, 11, false, http.StatusRequestEntityTooLarge},
+		{"/meta", ContentJSON, 20, false, http.StatusOK},
+		{"/meta", ContentJSON, 21, true, http.StatusRequestEntityTooLarge},
+		{"/route", ContentJSON, 30, true, http.StatusOK},
+		{"/route", ContentJSON, 31, false, http.StatusRequestEntityTooLarge},
+		{"/unlimited", ContentJSON, 1000, true, http.StatusOK},
+		{"/bind", ContentJSON, 40, true, http.StatusRequestEntityTooLarge},
+		// ContextRender parses forms before routing, with the limit passed to Classic
+		{"/", "application/x-www-form-urlencoded", 5002, true, http.StatusRequestEntityTooLarge},
+		{"/", "application/x-www-form-urlencoded", 11, false, http.StatusRequestEntityTooLarge},
+		{"/meta", "application/x-www-form-urlencoded", 15, true, http.StatusRequestEntityTooLarge},
+	} {
+		body := strings.Repeat("a", tt.size)
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", tt.path, strings.NewReader(body))
+		if !tt.contentLength {
+			req.Body = ioutil.NopCloser(strings.NewReader(body))
+			req.ContentLength = -1
+		}
+		req.Header.Set(ContentType, tt.contentType)
+		m.ServeHTTP(res, req)
+		expect(t, res.Code, tt.code)
+		if tt.code == http.StatusOK {
+			expect(t, res.Body.String(), body)
+		} else if !strings.Contains(res.Body.String(), "the request body is larger than") {
+			t.Errorf("%s: unexpected body %q", tt.path, res.Body.String())
+		}
+	}
+}
+
+func Test_BodyLimitRouteBelowRead(t *testing.T) {
+	m := Classic(BodyLimit(1 << 20))
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Use(func(req *http.Request) {
+		buf := make([]byte, 10)
+		io.ReadFull(req.Body, buf)
+	})
+	m.Post("/", BodyLimit(5), func(req *http.Request) {
+		ioutil.ReadAll(req.Body)
+	})
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(strings.Repeat("a", 20)))
+	req.Header.Set(ContentType, ContentJSON)
+	m.ServeHTTP(res, req)
+	expect(t, res.Code, http.StatusRequestEntityTooLarge)
+}
+
+func Test_BodyLimitMinRate(t *testing.T) {
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Use(BodyLimit(1000, BodyLimitOptions{MinRate: 100, Grace: 50 * time.Millisecond}))
+	m.Post("/", func(req *http.Request) {
+		ioutil.ReadAll(req.Body)
+	})
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	expect(t, err, nil)
+	defer conn.Close()
+	fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 100\r\n\r\nonly a few bytes")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	expect(t, err, nil)
+	expect(t, res.StatusCode, http.StatusRequestTimeout)
+	expect(t, res.Close, true)
+}
+
+// deadlineRecorder records the read deadlines set through http.ResponseController.
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadlines []time.Time
+}
+
+func (r *deadlineRecorder) SetReadDeadline(deadline time.Time) error {
+	r.deadlines = append(r.deadlines, deadline)
+	return nil
+}
+
+func Test_BodyLimitServerDeadline(t *testing.T) {
+	m := New()
+	m.Use(BodyLimit(1000, BodyLimitOptions{MinRate: 1, Grace: time.Hour}))
+	m.Use(func(req *http.Request) {
+		ioutil.ReadAll(req.Body)
+	})
+
+	for _, readTimeout := range []time.Duration{0, time.Minute} {
+		res := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+		req, _ := http.NewRequest("POST", "/", strings.NewReader("body"))
+		srv := &http.Server{ReadTimeout: readTimeout}
+		req = req.WithContext(gocontext.WithValue(req.Context(), http.ServerContextKey, srv))
+		m.ServeHTTP(res, req)
+		expect(t, res.Code, http.StatusOK)
+
+		refute(t, len(res.deadlines), 0)
+		for _, deadline := range res.deadlines[:len(res.deadlines)-1] {
+			if readTimeout > 0 && deadline.After(time.Now().Add(readTimeout)) {
+				t.Errorf("the deadline %v is past the server's ReadTimeout", deadline)
+			}
+		}
+		// the server's deadline is put back
+		restored := res.deadlines[len(res.deadlines)-1]
+		expect(t, restored.IsZero(), readTimeout == 0)
+		if readTimeout > 0 && restored.After(time.Now().Add(readTimeout)) {
+			t.Errorf("the restored deadline %v is past the server's ReadTimeout", restored)
+		}
+	}
+}
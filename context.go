@@ -8,6 +8,7 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
+	"errors"
 	"fmt"
 
 	"io/ioutil"
@@ -44,8 +45,15 @@ func ContextRender(cookiesecret string, options ...RenderOptions) Handler {
 		//set some default headers
 		tm := time.Now().UTC()
 
-		//ignore errors from ParseForm because it's usually harmless.
-		req.ParseForm()
+		//ignore errors from ParseForm because it's usually harmless,
+		//unless BodyLimit cut the body off.
+		if err := req.ParseForm(); err != nil {
+			var limitErr HTTPError
+			if errors.As(err, &limitErr) {
+				handleError(c, limitErr)
+				return
+			}
+		}
 		if len(req.Form) > 0 {
 			for k, v := range req.Form {
 				ctx.Form[k] = v[0]
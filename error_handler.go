@@ -0,0 +1,105 @@
+package martini
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/insionng/martini/inject"
+)
+
+// HTTPError is an error that knows the status code it should be answered with.
+type HTTPError interface {
+	error
+	StatusCode() int
+}
+
+// NewHTTPError returns an HTTPError with the status code and message.
+func NewHTTPError(status int, message string) HTTPError {
+	return &httpError{status, message}
+}
+
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func (e *httpError) StatusCode() int {
+	return e.status
+}
+
+// ErrorHandler is a service that Martini provides that is called when a handler returns a non-nil error, on its
+// own or as its last return value. The rest of the handler chain is skipped afterwards.
+// Map a different ErrorHandler to change how errors are answered.
+type ErrorHandler func(Context, error)
+
+// defaultErrorHandler answers with the status code of HTTPErrors or 500, as JSON if the request prefers it and
+// as HTML otherwise. The message of other errors is only shown in development, and they are logged.
+func defaultErrorHandler() ErrorHandler {
+	return func(c Context, err error) {
+		res := c.Get(inject.InterfaceOf((*http.ResponseWriter)(nil))).Interface().(http.ResponseWriter)
+		req := c.Get(requestType).Interface().(*http.Request)
+
+		status, message := http.StatusInternalServerError, err.Error()
+		if e, ok := err.(HTTPError); ok {
+			status = e.StatusCode()
+		} else {
+			if v := c.Get(reflect.TypeOf((*log.Logger)(nil))); v.IsValid() {
+				v.Interface().(*log.Logger).Printf("ERROR: %s %s: %v\n", req.Method, req.URL.Path, err)
+			}
+			if Env != Dev {
+				message = http.StatusText(status)
+			}
+		}
+
+		if prefersJSON(req) {
+			res.Header().Set(ContentType, ContentJSON+"; charset=utf-8")
+			res.WriteHeader(status)
+			json.NewEncoder(res).Encode(map[string]interface{}{"error": message, "status": status})
+			return
+		}
+		res.Header().Set(ContentType, ContentHTML+"; charset=utf-8")
+		res.WriteHeader(status)
+		title := fmt.Sprintf("%d %s", status, http.StatusText(status))
+		fmt.Fprintf(res, "<html><head><title>%s</title></head><body><h1>%s</h1><p>%s</p></body></html>",
+			title, title, html.EscapeString(message))
+	}
+}
+
+// prefersJSON reports whether the Accept header of the request asks for JSON before HTML.
+func prefersJSON(req *http.Request) bool {
+	accept := req.Header.Get("Accept")
+	j, h := strings.Index(accept, "json"), strings.Index(accept, "html")
+	return j >= 0 && (h < 0 || j < h)
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// returnedError splits the error a handler returned as its last value off the other values.
+func returnedError(vals []reflect.Value) ([]reflect.Value, error) {
+	if len(vals) == 0 {
+		return vals, nil
+	}
+	last := vals[len(vals)-1]
+	if !last.Type().Implements(errorType) || !canDeref(last) {
+		return vals, nil
+	}
+	if last.IsNil() {
+		return vals[:len(vals)-1], nil
+	}
+	return vals[:len(vals)-1], last.Interface().(error)
+}
+
+// handleError calls the ErrorHandler service for the error.
+func handleError(c Context, err error) {
+	handler := c.Get(reflect.TypeOf(ErrorHandler(nil))).Interface().(ErrorHandler)
+	handler(c, err)
+}
@@ -0,0 +1,101 @@
+package martini
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_ErrorHandler(t *testing.T) {
+	defer setENV(Env)
+	setENV(Dev)
+
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	result := ""
+	m.Get("/missing", func() error {
+		return NewHTTPError(http.StatusNotFound, "no such <user>")
+	}, func() {
+		result += "skipped"
+	})
+	m.Get("/broken", func() (string, error) {
+		return "", errors.New("db is down")
+	})
+	m.Get("/ok", func() (string, error) {
+		return "fine", nil
+	})
+	m.Get("/status", func() (int, string, error) {
+		return http.StatusCreated, "created", nil
+	})
+
+	for _, tt := range []struct {
+		path, accept string
+		code         int
+		body         string
+	}{
+		{"/missing", "text/html", http.StatusNotFound, "<p>no such &lt;user&gt;</p>"},
+		{"/missing", "application/json", http.StatusNotFound, `{"error":"no such \u003cuser\u003e","status":404}`},
+		{"/broken", "", http.StatusInternalServerError, "db is down"},
+		{"/ok", "", http.StatusOK, "fine"},
+		{"/status", "", http.StatusCreated, "created"},
+	} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept", tt.accept)
+		m.ServeHTTP(res, req)
+		expect(t, res.Code, tt.code)
+		if !strings.Contains(res.Body.String(), tt.body) {
+			t.Errorf("%s: expected %q in %q", tt.path, tt.body, res.Body.String())
+		}
+	}
+	expect(t, result, "")
+
+	// the messages of unexpected errors are hidden in production
+	setENV(Prod)
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/broken", nil)
+	m.ServeHTTP(res, req)
+	expect(t, strings.Contains(res.Body.String(), "db is down"), false)
+}
+
+func Test_ErrorHandler_Middleware(t *testing.T) {
+	m := New()
+	m.Map(ErrorHandler(func(c Context, err error) {
+		c.MapTo(err, (*error)(nil))
+	}))
+	result := ""
+	m.Use(func(c Context) {
+		c.Next()
+		result += "after"
+	})
+	m.Use(func() error {
+		return errors.New("unauthorized")
+	})
+	m.Action(func() {
+		result += "action"
+	})
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	m.ServeHTTP(res, req)
+	// a custom ErrorHandler that writes nothing still ends the chain
+	expect(t, result, "after")
+}
+
+func Test_PrefersJSON(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"":                                  false,
+		"application/json":                  true,
+		"text/html,application/json;q=0.9":  false,
+		"application/json, text/html":       true,
+		"application/problem+json, */*;q=1": true,
+	} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", accept)
+		expect(t, prefersJSON(req), expected)
+	}
+}
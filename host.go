@@ -0,0 +1,84 @@
+package martini
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// hostPattern matches the Host of a request against a pattern such as ":tenant.example.com".
+// Every :param matches a single label of the host name. Ports are ignored.
+type hostPattern struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+var hostParamRegexp = regexp.MustCompile(`:[a-zA-Z_][a-zA-Z0-9_]*`)
+
+func newHostPattern(pattern string) *hostPattern {
+	pattern = stripPort(pattern)
+	expr := ""
+	last := 0
+	for _, loc := range hostParamRegexp.FindAllStringIndex(pattern, -1) {
+		expr += regexp.QuoteMeta(pattern[last:loc[0]])
+		expr += `(?P<` + pattern[loc[0]+1:loc[1]] + `>[^.]+)`
+		last = loc[1]
+	}
+	expr += regexp.QuoteMeta(pattern[last:])
+
+	return &hostPattern{pattern, regexp.MustCompile(`(?i)^` + expr + `$`)}
+}
+
+// Match reports whether the host matches the pattern and returns the host params.
+func (h *hostPattern) Match(host string) (Params, bool) {
+	matches := h.regex.FindStringSubmatch(stripPort(host))
+	if matches == nil {
+		return nil, false
+	}
+
+	params := make(Params)
+	for i, name := range h.regex.SubexpNames() {
+		if len(name) > 0 {
+			params[name] = strings.ToLower(matches[i])
+		}
+	}
+	return params, true
+}
+
+// NumParams returns the number of params in the pattern.
+func (h *hostPattern) NumParams() int {
+	return h.regex.NumSubexp()
+}
+
+// URLWith returns the host replacing the params for the given values.
+func (h *hostPattern) URLWith(args []string) string {
+	i := 0
+	return hostParamRegexp.ReplaceAllStringFunc(h.pattern, func(m string) string {
+		if i < len(args) {
+			m = args[i]
+		}
+		i++
+		return m
+	})
+}
+
+// build returns the host with the params filled in.
+func (h *hostPattern) build(params Params) (host string, err error) {
+	host = hostParamRegexp.ReplaceAllStringFunc(h.pattern, func(m string) string {
+		v, ok := params[m[1:]]
+		if !ok || v == "" || strings.ContainsAny(v, "./:") {
+			err = fmt.Errorf("martini: missing or invalid host param %q for the host %q", m[1:], h.pattern)
+		}
+		return v
+	})
+	return host, err
+}
+
+func stripPort(host string) string {
+	h, port, err := net.SplitHostPort(host)
+	if err != nil || strings.Trim(port, "0123456789") != "" {
+		return host
+	}
+	return h
+}
@@ -0,0 +1,123 @@
+package martini
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// RouteInfo describes a registered route for debugging and tooling.
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+	Host    string `json:"host,omitempty"`
+	Name    string `json:"name,omitempty"`
+	// Middleware are the names of the functions of the group and Route.Use middleware, in the order they're called.
+	Middleware []string `json:"middleware"`
+	// Handlers are the names of the functions the route was added with.
+	Handlers []string               `json:"handlers"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+}
+
+// DescribeRoutes returns a RouteInfo for every route, in the order the routes were added.
+func DescribeRoutes(routes Routes) []RouteInfo {
+	all := routes.All()
+	infos := make([]RouteInfo, 0, len(all))
+	for _, r := range all {
+		handlers := r.Handlers()
+		middleware := 0
+		if rt, ok := r.(*route); ok {
+			middleware = rt.middleware
+		}
+
+		info := RouteInfo{
+			Method:     r.Method(),
+			Pattern:    r.Pattern(),
+			Host:       r.Host(),
+			Name:       r.GetName(),
+			Middleware: handlerNames(handlers[:middleware]),
+			Handlers:   handlerNames(handlers[middleware:]),
+		}
+		if meta := r.Metadata(); len(meta) > 0 {
+			info.Meta = meta
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// DumpRoutes writes a table of the routes with their middleware and handlers to w.
+func DumpRoutes(w io.Writer, routes Routes) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATTERN\tNAME\tMIDDLEWARE\tHANDLERS\tMETA")
+	for _, info := range DescribeRoutes(routes) {
+		pattern := info.Pattern
+		if info.Host != "" {
+			pattern = "//" + info.Host + pattern
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", info.Method, pattern, dash(info.Name),
+			dash(strings.Join(info.Middleware, " > ")), dash(strings.Join(info.Handlers, " > ")), dash(formatMeta(info.Meta)))
+	}
+	return tw.Flush()
+}
+
+// RoutesHandler returns a handler that lists the routes of the martini.Routes service. It responds with JSON
+// when the request accepts application/json and with the table of DumpRoutes otherwise.
+// Don't expose it in production, handler names tell a lot about an application.
+func RoutesHandler() Handler {
+	return func(res http.ResponseWriter, req *http.Request, routes Routes) {
+		if strings.Contains(req.Header.Get("Accept"), ContentJSON) {
+			res.Header().Set(ContentType, ContentJSON+"; charset=utf-8")
+			json.NewEncoder(res).Encode(DescribeRoutes(routes))
+			return
+		}
+		res.Header().Set(ContentType, ContentText+"; charset=utf-8")
+		DumpRoutes(res, routes)
+	}
+}
+
+func handlerNames(handlers []Handler) []string {
+	names := make([]string, len(handlers))
+	for i, h := range handlers {
+		names[i] = handlerName(h)
+	}
+	return names
+}
+
+// handlerName returns the name of the handler's function, such as "github.com/insionng/martini.Logger.func1".
+func handlerName(h Handler) string {
+	v := reflect.ValueOf(h)
+	if v.Kind() != reflect.Func {
+		return v.Type().String()
+	}
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return v.Type().String()
+}
+
+func formatMeta(meta map[string]interface{}) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", k, meta[k])
+	}
+	return strings.Join(pairs, " ")
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+package martini
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func requireScope(route Route, res http.ResponseWriter) {
+	if route.GetMeta("scope") == "admin" {
+		res.WriteHeader(http.StatusForbidden)
+	}
+}
+
+func listUsers() string {
+	return "users"
+}
+
+func Test_RouteMeta(t *testing.T) {
+	router := NewRouter()
+	router.Group("/admin", func(r Router) {
+		r.Get("/users", listUsers).Meta("scope", "admin").Meta("tags", []string{"users"})
+	}, requireScope)
+	router.Get("/users", listUsers).Use(requireScope)
+
+	for path, code := range map[string]int{"/admin/users": http.StatusForbidden, "/users": http.StatusOK} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.Handle(recorder, req, New().createContext(recorder, req))
+		expect(t, recorder.Code, code)
+	}
+
+	r := router.All()[0]
+	expect(t, r.GetMeta("scope"), "admin")
+	expect(t, r.GetMeta("missing"), nil)
+	meta := r.Metadata()
+	delete(meta, "scope")
+	expect(t, len(r.Metadata()), 2)
+}
+
+func Test_DescribeRoutes(t *testing.T) {
+	router := NewRouter()
+	router.Group("/admin", func(r Router) {
+		r.Get("/users", listUsers).Use(Logger()).Meta("scope", "admin")
+	}, requireScope)
+	router.Post("/users", listUsers).Name("createUser")
+
+	infos := DescribeRoutes(router)
+	expect(t, len(infos), 2)
+	expect(t, infos[0].Pattern, "/admin/users")
+	expectDeep(t, infos[0].Middleware, []string{
+		"github.com/insionng/martini.requireScope",
+		"github.com/insionng/martini.Logger.func1",
+	})
+	expectDeep(t, infos[0].Handlers, []string{"github.com/insionng/martini.listUsers"})
+	expectDeep(t, infos[0].Meta, map[string]interface{}{"scope": "admin"})
+	expect(t, infos[1].Name, "createUser")
+	expect(t, len(infos[1].Middleware), 0)
+
+	var buf bytes.Buffer
+	expect(t, DumpRoutes(&buf, router), nil)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expect(t, len(lines), 3)
+	expect(t, strings.Fields(lines[0])[0], "METHOD")
+	expectDeep(t, strings.Fields(lines[2]), []string{"POST", "/users", "createUser", "-", "github.com/insionng/martini.listUsers", "-"})
+}
+
+func Test_RoutesHandler(t *testing.T) {
+	m := Classic()
+	m.Get("/users", listUsers).Meta("scope", "admin")
+	m.Get("/debug/routes", RoutesHandler())
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/routes", nil)
+	req.Header.Set("Accept", "application/json")
+	m.ServeHTTP(res, req)
+
+	expect(t, res.Code, http.StatusOK)
+	var infos []RouteInfo
+	expect(t, json.Unmarshal(res.Body.Bytes(), &infos), nil)
+	expect(t, len(infos), 2)
+	expect(t, infos[0].Meta["scope"], "admin")
+
+	res = httptest.NewRecorder()
+	req.Header.Del("Accept")
+	m.ServeHTTP(res, req)
+	expect(t, strings.HasPrefix(res.Header().Get(ContentType), ContentText), true)
+	expect(t, strings.Contains(res.Body.String(), "/debug/routes"), true)
+}
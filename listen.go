@@ -0,0 +1,123 @@
+package martini
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFdsStart is the first file descriptor passed by the socket activation protocol.
+const listenFdsStart = 3
+
+// listeners opens the listeners the options ask for. If any of them fails, the ones already open are closed.
+func (opt *RunOptions) listeners() (listeners []net.Listener, err error) {
+	defer func() {
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			listeners = nil
+		}
+	}()
+
+	if opt.Listener != nil {
+		listeners = append(listeners, opt.Listener)
+	}
+	listeners = append(listeners, opt.Listeners...)
+	if opt.SystemdListeners {
+		inherited, err := systemdListeners()
+		listeners = append(listeners, inherited...)
+		if err != nil {
+			return listeners, err
+		}
+	}
+
+	addrs := opt.Addrs
+	if opt.Addr != "" {
+		addrs = append([]string{opt.Addr}, addrs...)
+	}
+	if len(addrs) == 0 && len(listeners) == 0 {
+		addrs = []string{defaultAddr()}
+	}
+	for _, addr := range addrs {
+		ln, err := listen(addr, opt.UnixSocketMode)
+		if err != nil {
+			return listeners, err
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// defaultAddr returns the address made of os.Getenv("HOST") and os.Getenv("PORT") or 9000.
+func defaultAddr() string {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "9000"
+	}
+	return os.Getenv("HOST") + ":" + port
+}
+
+// listen listens on a TCP address or, for addresses starting with "unix:", on a Unix domain socket.
+func listen(addr string, mode os.FileMode) (net.Listener, error) {
+	if !strings.HasPrefix(addr, "unix:") {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, "unix:")
+	// remove a socket left over by a process that didn't shut down cleanly
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("martini: the socket %s is in use", path)
+		}
+		os.Remove(path)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// systemdListeners returns the listeners passed to the process with the LISTEN_PID, LISTEN_FDS and
+// LISTEN_FDNAMES environment variables. The variables are unset so child processes don't pick them up.
+func systemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	var listeners []net.Listener
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFdsStart+i), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return listeners, fmt.Errorf("martini: inherited socket %s: %v", name, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,105 @@
+package martini
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func Test_RunWithOptions_Listeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "martini-listen")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "app.sock")
+
+	m := New()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Action(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("hello"))
+	})
+	started := make(chan struct{})
+	m.OnStart(func() {
+		close(started)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	expect(t, err, nil)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- m.RunWithOptions(RunOptions{
+			Listener:       ln,
+			Addrs:          []string{"unix:" + sock},
+			UnixSocketMode: 0600,
+			DisableSignals: true,
+		})
+	}()
+	<-started
+
+	fi, err := os.Stat(sock)
+	expect(t, err, nil)
+	expect(t, fi.Mode().Perm(), os.FileMode(0600))
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx gocontext.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", sock)
+		},
+	}}
+	for _, tt := range []struct {
+		client *http.Client
+		url    string
+	}{
+		{http.DefaultClient, "http://" + ln.Addr().String()},
+		{unixClient, "http://unix/"},
+	} {
+		res, err := tt.client.Get(tt.url)
+		expect(t, err, nil)
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		expect(t, string(body), "hello")
+	}
+
+	expect(t, m.Shutdown(gocontext.Background()), nil)
+	expect(t, <-errc, nil)
+
+	_, err = net.Dial("tcp", ln.Addr().String())
+	refute(t, err, nil)
+	_, err = os.Stat(sock)
+	expect(t, os.IsNotExist(err), true)
+}
+
+func Test_Listen_StaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "martini-listen")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "app.sock")
+
+	ln, err := listen("unix:"+sock, 0)
+	expect(t, err, nil)
+	_, err = listen("unix:"+sock, 0)
+	refute(t, err, nil)
+
+	// a socket nobody listens on any more is replaced
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	ln, err = listen("unix:"+sock, 0)
+	expect(t, err, nil)
+	ln.Close()
+}
+
+func Test_SystemdListeners_OtherProcess(t *testing.T) {
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	listeners, err := systemdListeners()
+	expect(t, err, nil)
+	expect(t, len(listeners), 0)
+	expect(t, os.Getenv("LISTEN_FDS"), "1")
+}
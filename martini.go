@@ -18,10 +18,13 @@
 package martini
 
 import (
+	gocontext "context"
+	"crypto/x509"
 	"log"
 	"net/http"
 	"os"
 	"reflect"
+	"sync"
 
 	"github.com/insionng/martini/inject"
 )
@@ -32,6 +35,11 @@ type Martini struct {
 	handlers []Handler
 	action   Handler
 	logger   *log.Logger
+
+	onStart    []Handler
+	onShutdown []Handler
+	mu         sync.Mutex
+	state      *serverState
 }
 
 // New creates a bare bones Martini instance. Use this method if you want to have full control over the middleware that is used.
@@ -39,6 +47,7 @@ func New() *Martini {
 	m := &Martini{Injector: inject.New(), action: func() {}, logger: log.New(os.Stdout, "[martini] ", 0)}
 	m.Map(m.logger)
 	m.Map(defaultReturnHandler())
+	m.Map(defaultErrorHandler())
 	return m
 }
 
@@ -69,19 +78,13 @@ func (m *Martini) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	m.createContext(res, req).run()
 }
 
-// Run the http server. Listening on os.GetEnv("PORT") or 3000 by default.
+// Run the http server. Listening on os.GetEnv("PORT") or 9000 by default.
+// The server shuts down gracefully on SIGINT and SIGTERM, see RunWithOptions.
 func (m *Martini) Run() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "9000"
+	if err := m.RunWithOptions(); err != nil {
+		logger := m.Injector.Get(reflect.TypeOf(m.logger)).Interface().(*log.Logger)
+		logger.Fatalln(err)
 	}
-
-	host := os.Getenv("HOST")
-
-	logger := m.Injector.Get(reflect.TypeOf(m.logger)).Interface().(*log.Logger)
-
-	logger.Printf("listening on %s:%s (%s)\n", host, port, Env)
-	logger.Fatalln(http.ListenAndServe(host+":"+port, m))
 }
 
 func (m *Martini) createContext(res http.ResponseWriter, req *http.Request) *context {
@@ -90,6 +93,19 @@ func (m *Martini) createContext(res http.ResponseWriter, req *http.Request) *con
 	c.MapTo(c, (*Context)(nil))
 	c.MapTo(c.rw, (*http.ResponseWriter)(nil))
 	c.Map(req)
+	if req == nil {
+		return c
+	}
+	// cancelled when the client goes away, see SetRequestContext
+	c.MapTo(req.Context(), (*gocontext.Context)(nil))
+	if req.TLS != nil {
+		// the client certificate verified by mutual TLS, nil if the client sent none
+		var peer *x509.Certificate
+		if len(req.TLS.VerifiedChains) > 0 {
+			peer = req.TLS.VerifiedChains[0][0]
+		}
+		c.Map(peer)
+	}
 	return c
 }
 
@@ -101,11 +117,19 @@ type ClassicMartini struct {
 
 // Classic creates a classic Martini with some basic default middleware - martini.Logger, martini.Recovery and martini.Static.
 // Classic also maps martini.Routes as a service.
-func Classic() *ClassicMartini {
+//
+// The middleware passed to Classic is added after Recovery, before martini.ContextRender parses the form. Pass
+// middleware that has to see the request body first, like BodyLimit:
+//
+//	m := martini.Classic(martini.BodyLimit(1 << 20))
+func Classic(middleware ...Handler) *ClassicMartini {
 	r := NewRouter()
 	m := New()
 	m.Use(Logger())
 	m.Use(Recovery())
+	for _, h := range middleware {
+		m.Use(h)
+	}
 	m.Use(Static("static"))
 	m.Use(ContextRender("", RenderOptions{
 		Extensions: []string{".html", ".tmpl", "tpl"},
@@ -165,10 +189,16 @@ func (c *context) Written() bool {
 
 func (c *context) run() {
 	for c.index <= len(c.handlers) {
-		_, err := c.Invoke(c.handler())
+		vals, err := c.Invoke(c.handler())
 		if err != nil {
 			panic(err)
 		}
+		if _, err := returnedError(vals); err != nil {
+			handleError(c, err)
+			// skip the rest of the handlers
+			c.index = len(c.handlers) + 1
+			return
+		}
 		c.index += 1
 
 		if c.Written() {
@@ -0,0 +1,82 @@
+package martini
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/insionng/martini/inject"
+)
+
+// Mount serves every request below the prefix with the given *Martini, *ClassicMartini or http.Handler.
+// The prefix is stripped from the request path before it is passed on, and it may contain params.
+// A mounted Martini runs its own middleware stack and keeps the Params of the prefix. Services that aren't
+// mapped in the mounted Martini are looked up in the request context of the app it's mounted in.
+func (r *router) Mount(prefix string, handler interface{}) {
+	var serve func(http.ResponseWriter, *http.Request, Context, Params)
+	switch h := handler.(type) {
+	case *ClassicMartini:
+		serve = h.Martini.serveMounted
+	case *Martini:
+		serve = h.serveMounted
+	case http.Handler:
+		serve = func(res http.ResponseWriter, req *http.Request, c Context, params Params) {
+			h.ServeHTTP(res, req)
+		}
+	default:
+		panic("martini: Mount expects a *Martini, a *ClassicMartini or an http.Handler")
+	}
+
+	prefix = strings.TrimRight(prefix, "/")
+	// the wildcard that catches the path below the prefix comes after any wildcard in the prefix
+	key := "_" + strconv.Itoa(strings.Count(prefix, "**")+1)
+	mounted := func(res http.ResponseWriter, req *http.Request, c Context, params Params) {
+		rest := "/" + params[key]
+		inner := make(Params, len(params))
+		for k, v := range params {
+			if k != key {
+				inner[k] = v
+			}
+		}
+		serve(res, stripPrefix(req, rest), c, inner)
+	}
+
+	r.Any(prefix, mounted)
+	r.Any(prefix+"/**", mounted)
+}
+
+// stripPrefix returns a shallow copy of the request with the given path.
+func stripPrefix(req *http.Request, path string) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	r.URL = new(url.URL)
+	*r.URL = *req.URL
+	r.URL.Path = path
+	r.URL.RawPath = ""
+	return r
+}
+
+// serveMounted serves a request for the Martini when it is mounted under another app's router.
+func (m *Martini) serveMounted(res http.ResponseWriter, req *http.Request, parent Context, params Params) {
+	c := m.createContext(res, req)
+	c.SetParent(&mountInjector{m.Injector, parent})
+	c.Map(params)
+	c.run()
+}
+
+// mountInjector looks services up in a mounted Martini first and falls back to the request context of the
+// app it is mounted in.
+type mountInjector struct {
+	inject.Injector
+	parent Context
+}
+
+func (i *mountInjector) Get(t reflect.Type) reflect.Value {
+	val := i.Injector.Get(t)
+	if !val.IsValid() {
+		val = i.parent.Get(t)
+	}
+	return val
+}
@@ -0,0 +1,93 @@
+package martini
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Mount_Martini(t *testing.T) {
+	result := ""
+
+	sub := Classic()
+	sub.Map(log.New(ioutil.Discard, "", 0))
+	sub.Use(func(c Context) {
+		result += "sub"
+	})
+	sub.Get("/users/:id", func(params Params, req *http.Request, s *service) string {
+		expect(t, params["tenant"], "acme")
+		expect(t, params["id"], "7")
+		expect(t, params["_1"], "")
+		expect(t, req.URL.Path, "/users/7")
+		expect(t, s.name, "parent")
+		return "user"
+	})
+	sub.Get("/", func() string {
+		return "index"
+	})
+
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Map(&service{"parent"})
+	m.Use(func(c Context) {
+		result += "parent"
+	})
+	m.Mount("/tenants/:tenant/", sub)
+
+	for path, body := range map[string]string{
+		"/tenants/acme/users/7": "user",
+		"/tenants/acme":         "index",
+		"/tenants/acme/":        "index",
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:9000"+path, nil)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.Code, http.StatusOK)
+		expect(t, recorder.Body.String(), body)
+	}
+	expect(t, result, "parentsubparentsubparentsub")
+
+	// the mounted app's own 404
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:9000/tenants/acme/nope", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusNotFound)
+}
+
+func Test_Mount_Handler(t *testing.T) {
+	router := NewRouter()
+	router.Mount("/static", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(req.URL.Path))
+	}))
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:9000/static/css/app.css", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Body.String(), "/css/app.css")
+	expect(t, req.URL.Path, "/static/css/app.css")
+}
+
+type service struct {
+	name string
+}
+
+func Test_RedirectInMountedApp(t *testing.T) {
+	sub := New()
+	r := NewRouter(RouterOptions{TrailingSlash: TrailingSlashRedirect, RedirectStatus: http.StatusFound})
+	r.Get("/users", func() {})
+	sub.Action(r.Handle)
+
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Mount("/api", sub)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users/", nil)
+	req.RequestURI = "/api/users/"
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusFound)
+	expect(t, recorder.Header().Get("Location"), "/api/users")
+}
@@ -0,0 +1,107 @@
+package martini
+
+import (
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder writes v to w in the format of the media type it is registered for.
+type Encoder func(w io.Writer, v interface{}) error
+
+type encoderEntry struct {
+	mediaType string
+	encoder   Encoder
+}
+
+var (
+	encodersMu sync.RWMutex
+	encoders   []encoderEntry
+)
+
+// RegisterEncoder lets the ReturnHandler answer requests that accept the media type, such as "text/csv",
+// for handlers that return structs, maps or slices. JSON and XML are built in and rendered like Render.JSON and
+// Render.XML do. Registering a media type again replaces its encoder.
+func RegisterEncoder(mediaType string, encoder Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	for i, e := range encoders {
+		if e.mediaType == mediaType {
+			encoders[i].encoder = encoder
+			return
+		}
+	}
+	encoders = append(encoders, encoderEntry{mediaType, encoder})
+}
+
+// encoderFor returns the registered encoder for the media type.
+func encoderFor(mediaType string) (Encoder, bool) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	for _, e := range encoders {
+		if e.mediaType == mediaType {
+			return e.encoder, true
+		}
+	}
+	return nil, false
+}
+
+// offeredTypes returns the media types return values can be rendered as, JSON first.
+func offeredTypes() []string {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	offers := []string{ContentJSON, "application/xml", ContentXML}
+	for _, e := range encoders {
+		offers = append(offers, e.mediaType)
+	}
+	return offers
+}
+
+// negotiate returns the offer the Accept header prefers, or "" if it accepts none of them. The offers are in
+// the order the server prefers them, the first one is used when the request has no Accept header.
+func negotiate(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			s := matchMediaType(mediaType, offer)
+			if s <= specificity {
+				continue
+			}
+			specificity, q = s, 1.0
+			if v, ok := params["q"]; ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// matchMediaType returns how specifically the accepted media type matches the offer: 2 for the exact type,
+// 1 for type/*, 0 for */* and -1 if it doesn't match.
+func matchMediaType(accepted, offer string) int {
+	switch {
+	case accepted == offer:
+		return 2
+	case accepted == "*/*":
+		return 0
+	case strings.HasSuffix(accepted, "/*") && strings.HasPrefix(offer, accepted[:len(accepted)-1]):
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,448 @@
+package martini
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIDoc describes a route in the OpenAPI documents generated by OpenAPI. Set it with Route.Doc.
+type APIDoc struct {
+	// Summary is a short summary of what the route does.
+	Summary string
+	// Description is a longer explanation of the route.
+	Description string
+	// Tags groups the route with others in the documentation.
+	Tags []string
+	// Deprecated marks the route as deprecated.
+	Deprecated bool
+	// Request is a value of the type of the JSON request body, if there is one.
+	Request interface{}
+	// Responses maps status codes to a value of the type of the JSON response body, or nil if there is no body.
+	// Defaults to a 200 response without a body.
+	Responses map[int]interface{}
+}
+
+// OpenAPIOptions is a struct for specifying the details of an OpenAPI document.
+type OpenAPIOptions struct {
+	// Title of the API. Defaults to "API".
+	Title string
+	// Version of the API. Defaults to "1.0.0".
+	Version string
+	// Description of the API.
+	Description string
+	// Servers lists the URLs the API is served at.
+	Servers []string
+}
+
+func prepareOpenAPIOptions(options []OpenAPIOptions) OpenAPIOptions {
+	var opt OpenAPIOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	// Defaults
+	if len(opt.Title) == 0 {
+		opt.Title = "API"
+	}
+	if len(opt.Version) == 0 {
+		opt.Version = "1.0.0"
+	}
+	return opt
+}
+
+// OpenAPIDocument is an OpenAPI 3 document. It encodes to JSON as it is.
+type OpenAPIDocument map[string]interface{}
+
+// openAPIMethods are the methods an Any route is documented with.
+var openAPIMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// OpenAPI generates an OpenAPI 3 document describing the routes. Routes added with Any are only included if
+// they have been described with Route.Doc, their operationIds get the method as a suffix, like "petsGet".
+func OpenAPI(routes Routes, options ...OpenAPIOptions) OpenAPIDocument {
+	opt := prepareOpenAPIOptions(options)
+	schemas := &schemaBuilder{map[string]interface{}{}, map[reflect.Type]string{}}
+	paths := map[string]interface{}{}
+
+	for _, r := range routes.All() {
+		doc := r.GetDoc()
+		methods := []string{r.Method()}
+		if r.Method() == "*" {
+			if reflect.DeepEqual(doc, APIDoc{}) {
+				continue
+			}
+			methods = openAPIMethods
+		}
+
+		path, params := openAPIPath(r.Pattern())
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		if r.Host() != "" {
+			// host params become variables of a server for the path
+			variables := map[string]interface{}{}
+			host := hostParamRegexp.ReplaceAllStringFunc(r.Host(), func(m string) string {
+				variables[m[1:]] = map[string]interface{}{"default": m[1:]}
+				return "{" + m[1:] + "}"
+			})
+			server := map[string]interface{}{"url": "//" + host}
+			if len(variables) > 0 {
+				server["variables"] = variables
+			}
+			item["servers"] = []interface{}{server}
+		}
+		for _, method := range methods {
+			op := schemas.operation(r, doc, params)
+			if id, ok := op["operationId"].(string); ok && len(methods) > 1 {
+				// operationIds have to be unique
+				op["operationId"] = id + method[:1] + strings.ToLower(method[1:])
+			}
+			item[strings.ToLower(method)] = op
+		}
+	}
+
+	info := map[string]interface{}{"title": opt.Title, "version": opt.Version}
+	if opt.Description != "" {
+		info["description"] = opt.Description
+	}
+	d := OpenAPIDocument{
+		"openapi": "3.0.3",
+		"info":    info,
+		"paths":   paths,
+	}
+	if len(opt.Servers) > 0 {
+		servers := []interface{}{}
+		for _, s := range opt.Servers {
+			servers = append(servers, map[string]interface{}{"url": s})
+		}
+		d["servers"] = servers
+	}
+	if len(schemas.components) > 0 {
+		d["components"] = map[string]interface{}{"schemas": schemas.components}
+	}
+	return d
+}
+
+// OpenAPIHandler returns a handler that serves the OpenAPI document for the martini.Routes service with Render.JSON.
+// It requires the martini.Render service.
+//
+//	m.Get("/openapi.json", martini.OpenAPIHandler(martini.OpenAPIOptions{Title: "Pets"}))
+func OpenAPIHandler(options ...OpenAPIOptions) Handler {
+	return func(routes Routes, r *Render) {
+		r.JSON(http.StatusOK, OpenAPI(routes, options...))
+	}
+}
+
+// JSON returns the document encoded as JSON.
+func (d OpenAPIDocument) JSON() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+// YAML returns the document encoded as YAML.
+func (d OpenAPIDocument) YAML() ([]byte, error) {
+	// go through JSON to get plain maps, slices and numbers
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	writeYAML(buf, v, 0)
+	return buf.Bytes(), nil
+}
+
+type openAPIParam struct {
+	name       string
+	constraint string
+}
+
+// openAPIPath translates a route pattern into an OpenAPI path, turning params and wildcards into {name}.
+func openAPIPath(pattern string) (string, []openAPIParam) {
+	var buf bytes.Buffer
+	var params []openAPIParam
+	err := walkPattern(pattern, func(literal string) {
+		buf.WriteString(literal)
+	}, func(name, constraint string, wildcard bool) error {
+		buf.WriteString("{" + name + "}")
+		params = append(params, openAPIParam{name, constraint})
+		return nil
+	})
+	if err != nil {
+		// document patterns with raw regexps as they are
+		return pattern, nil
+	}
+	if buf.Len() == 0 {
+		return "/", params
+	}
+	return buf.String(), params
+}
+
+// paramSchema describes the values a param with the constraint can take.
+func paramSchema(constraint string) map[string]interface{} {
+	switch constraint {
+	case paramConstraints["int"]:
+		return map[string]interface{}{"type": "integer"}
+	case paramConstraints["uint"]:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case paramConstraints["uuid"]:
+		return map[string]interface{}{"type": "string", "format": "uuid"}
+	case paramRegexp, `[^#?]*`:
+		return map[string]interface{}{"type": "string"}
+	}
+	return map[string]interface{}{"type": "string", "pattern": "^(?:" + constraint + ")$"}
+}
+
+// schemaBuilder turns Go types into schemas, collecting named struct types as components.
+type schemaBuilder struct {
+	components map[string]interface{}
+	names      map[reflect.Type]string
+}
+
+func (b *schemaBuilder) operation(r Route, doc APIDoc, params []openAPIParam) map[string]interface{} {
+	op := map[string]interface{}{}
+	if r.GetName() != "" {
+		op["operationId"] = r.GetName()
+	}
+	if doc.Summary != "" {
+		op["summary"] = doc.Summary
+	}
+	if doc.Description != "" {
+		op["description"] = doc.Description
+	}
+	if len(doc.Tags) > 0 {
+		op["tags"] = doc.Tags
+	}
+	if doc.Deprecated {
+		op["deprecated"] = true
+	}
+
+	if len(params) > 0 {
+		var parameters []interface{}
+		for _, p := range params {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     p.name,
+				"in":       "path",
+				"required": true,
+				"schema":   paramSchema(p.constraint),
+			})
+		}
+		op["parameters"] = parameters
+	}
+
+	if doc.Request != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  b.content(doc.Request),
+		}
+	}
+
+	responses := map[string]interface{}{}
+	for status, v := range doc.Responses {
+		response := map[string]interface{}{"description": http.StatusText(status)}
+		if v != nil {
+			response["content"] = b.content(v)
+		}
+		responses[strconv.Itoa(status)] = response
+	}
+	if len(responses) == 0 {
+		responses["200"] = map[string]interface{}{"description": http.StatusText(http.StatusOK)}
+	}
+	op["responses"] = responses
+
+	return op
+}
+
+func (b *schemaBuilder) content(v interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		ContentJSON: map[string]interface{}{"schema": b.schema(reflect.TypeOf(v))},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		name, ok := b.names[t]
+		if !ok {
+			// register the name first in case the type refers to itself
+			name = b.componentName(t)
+			b.names[t] = name
+			b.components[name] = nil
+			b.components[name] = b.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// componentName returns a name for the schema of the type that no other type has. Types are named like they
+// are in Go, a type that has the name of another one from a different package is qualified with its package.
+func (b *schemaBuilder) componentName(t reflect.Type) string {
+	name := componentNameRegexp.ReplaceAllString(t.Name(), "_")
+	if _, taken := b.components[name]; !taken {
+		return name
+	}
+	name = componentNameRegexp.ReplaceAllString(path.Base(t.PkgPath())+"."+t.Name(), "_")
+	unique := name
+	for i := 2; ; i++ {
+		if _, taken := b.components[unique]; !taken {
+			return unique
+		}
+		unique = name + strconv.Itoa(i)
+	}
+}
+
+// componentNameRegexp matches the characters component names can't have.
+var componentNameRegexp = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// object describes a struct the way encoding/json encodes it.
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	b.fields(t, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (b *schemaBuilder) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			b.fields(ft, properties, required)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = b.schema(f.Type)
+		if !strings.Contains(opts, ",omitempty") && f.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// writeYAML writes the plain maps, slices and scalars decoded from JSON as YAML.
+func writeYAML(buf *bytes.Buffer, v interface{}, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.WriteString(pad + strconv.Quote(k) + ":")
+			writeYAMLValue(buf, v[k], indent)
+		}
+	case []interface{}:
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok && len(m) > 0 {
+				// put the first key of a map on the same line as the dash
+				item := new(bytes.Buffer)
+				writeYAML(item, m, indent+2)
+				buf.WriteString(pad + "- ")
+				buf.Write(item.Bytes()[indent+2:])
+				continue
+			}
+			buf.WriteString(pad + "-")
+			writeYAMLValue(buf, item, indent)
+		}
+	}
+}
+
+func writeYAMLValue(buf *bytes.Buffer, v interface{}, indent int) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+		buf.WriteString("\n")
+		writeYAML(buf, val, indent+2)
+	case []interface{}:
+		if len(val) == 0 {
+			buf.WriteString(" []\n")
+			return
+		}
+		buf.WriteString("\n")
+		writeYAML(buf, val, indent+2)
+	case string:
+		buf.WriteString(" " + strconv.Quote(val) + "\n")
+	case json.Number:
+		buf.WriteString(" " + val.String() + "\n")
+	case bool:
+		buf.WriteString(" " + strconv.FormatBool(val) + "\n")
+	default:
+		buf.WriteString(" null\n")
+	}
+}
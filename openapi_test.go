@@ -0,0 +1,174 @@
+package martini
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pet struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Tags    []string  `json:"tags,omitempty"`
+	Owner   *pet      `json:"owner"`
+	Born    time.Time `json:"born"`
+	private string
+}
+
+type apiError struct {
+	Message string
+}
+
+func Test_OpenAPI(t *testing.T) {
+	router := NewRouter()
+	get := router.Get("/pets/:id<int>", func() {})
+	get.Name("getPet")
+	get.Doc(APIDoc{
+		Summary:   "Find a pet",
+		Tags:      []string{"pets"},
+		Responses: map[int]interface{}{200: pet{}, 404: &apiError{}},
+	})
+	router.Post("/pets", func() {}).Doc(APIDoc{Request: pet{}, Responses: map[int]interface{}{201: nil}})
+	router.Get("/files/**", func() {})
+	router.Any("/undocumented", func() {})
+	router.Host(":tenant.example.com", func(r Router) {
+		r.Delete("/pets/:name", func() {}).Doc(APIDoc{Deprecated: true})
+	})
+
+	d := OpenAPI(router, OpenAPIOptions{Title: "Pets", Servers: []string{"https://api.example.com"}})
+	expectDeep(t, d["openapi"], "3.0.3")
+	expectDeep(t, d["info"], map[string]interface{}{"title": "Pets", "version": "1.0.0"})
+	expectDeep(t, d["servers"], []interface{}{map[string]interface{}{"url": "https://api.example.com"}})
+
+	paths := d["paths"].(map[string]interface{})
+	expectDeep(t, len(paths), 4)
+
+	op := paths["/pets/{id}"].(map[string]interface{})["get"].(map[string]interface{})
+	expectDeep(t, op["operationId"], "getPet")
+	expectDeep(t, op["summary"], "Find a pet")
+	expectDeep(t, op["parameters"], []interface{}{map[string]interface{}{
+		"name": "id", "in": "path", "required": true, "schema": map[string]interface{}{"type": "integer"},
+	}})
+	responses := op["responses"].(map[string]interface{})
+	expectDeep(t, responses["404"], map[string]interface{}{
+		"description": "Not Found",
+		"content": map[string]interface{}{"application/json": map[string]interface{}{
+			"schema": map[string]interface{}{"$ref": "#/components/schemas/apiError"},
+		}},
+	})
+
+	post := paths["/pets"].(map[string]interface{})["post"].(map[string]interface{})
+	expectDeep(t, post["responses"], map[string]interface{}{"201": map[string]interface{}{"description": "Created"}})
+	expectDeep(t, post["requestBody"].(map[string]interface{})["required"], true)
+
+	files := paths["/files/{_1}"].(map[string]interface{})["get"].(map[string]interface{})
+	expectDeep(t, files["responses"], map[string]interface{}{"200": map[string]interface{}{"description": "OK"}})
+
+	item := paths["/pets/{name}"].(map[string]interface{})
+	expectDeep(t, item["delete"].(map[string]interface{})["deprecated"], true)
+	expectDeep(t, item["servers"], []interface{}{map[string]interface{}{
+		"url":       "//{tenant}.example.com",
+		"variables": map[string]interface{}{"tenant": map[string]interface{}{"default": "tenant"}},
+	}})
+
+	schemas := d["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	petSchema := schemas["pet"].(map[string]interface{})
+	expectDeep(t, petSchema["required"], []string{"id", "name", "born"})
+	properties := petSchema["properties"].(map[string]interface{})
+	expectDeep(t, len(properties), 5)
+	expectDeep(t, properties["owner"], map[string]interface{}{"$ref": "#/components/schemas/pet"})
+	expectDeep(t, properties["born"], map[string]interface{}{"type": "string", "format": "date-time"})
+	expectDeep(t, properties["tags"], map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}})
+	expectDeep(t, schemas["apiError"].(map[string]interface{})["required"], []string{"Message"})
+}
+
+// Cookie has the name of http.Cookie.
+type Cookie struct {
+	Flavor string `json:"flavor"`
+}
+
+func Test_OpenAPI_UniqueNames(t *testing.T) {
+	router := NewRouter()
+	router.Get("/cookies", func() {}).Doc(APIDoc{Responses: map[int]interface{}{200: Cookie{}}})
+	router.Get("/session", func() {}).Doc(APIDoc{Responses: map[int]interface{}{200: http.Cookie{}}})
+	pets := router.Any("/pets", func() {})
+	pets.Name("pets")
+	pets.Doc(APIDoc{Summary: "Pets"})
+
+	d := OpenAPI(router)
+	schemas := d["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	expectDeep(t, len(schemas), 2)
+	expectDeep(t, schemas["Cookie"].(map[string]interface{})["required"], []string{"flavor"})
+	refute(t, schemas["http.Cookie"], nil)
+
+	paths := d["paths"].(map[string]interface{})
+	session := paths["/session"].(map[string]interface{})["get"].(map[string]interface{})
+	expectDeep(t, session["responses"].(map[string]interface{})["200"].(map[string]interface{})["content"], map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/http.Cookie"}},
+	})
+
+	ids := map[string]bool{}
+	for method, op := range paths["/pets"].(map[string]interface{}) {
+		id := op.(map[string]interface{})["operationId"].(string)
+		expectDeep(t, id, "pets"+strings.ToUpper(method[:1])+method[1:])
+		ids[id] = true
+	}
+	expectDeep(t, len(ids), 5)
+}
+
+func Test_OpenAPI_YAML(t *testing.T) {
+	router := NewRouter()
+	router.Get("/pets/:id", func() {}).Doc(APIDoc{Tags: []string{"pets"}})
+
+	data, err := OpenAPI(router).YAML()
+	expectDeep(t, err, nil)
+	expectDeep(t, string(data), strings.Join([]string{
+		`"info":`,
+		`  "title": "API"`,
+		`  "version": "1.0.0"`,
+		`"openapi": "3.0.3"`,
+		`"paths":`,
+		`  "/pets/{id}":`,
+		`    "get":`,
+		`      "parameters":`,
+		`        - "in": "path"`,
+		`          "name": "id"`,
+		`          "required": true`,
+		`          "schema":`,
+		`            "type": "string"`,
+		`      "responses":`,
+		`        "200":`,
+		`          "description": "OK"`,
+		`      "tags":`,
+		`        - "pets"`,
+		``,
+	}, "\n"))
+}
+
+func Test_OpenAPIHandler(t *testing.T) {
+	m := Classic()
+	m.Get("/pets", func() {})
+	m.Get("/openapi.json", OpenAPIHandler(OpenAPIOptions{Version: "2.0"}))
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	m.ServeHTTP(res, req)
+
+	expectDeep(t, res.Code, http.StatusOK)
+	var d map[string]interface{}
+	expectDeep(t, json.Unmarshal(res.Body.Bytes(), &d), nil)
+	expectDeep(t, d["info"], map[string]interface{}{"title": "API", "version": "2.0"})
+	paths := d["paths"].(map[string]interface{})
+	expectDeep(t, len(paths), 2)
+	expectDeep(t, paths["/pets"] != nil, true)
+}
+
+func expectDeep(t *testing.T, a interface{}, b interface{}) {
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("Expected %v (type %v) - Got %v (type %v)", b, reflect.TypeOf(b), a, reflect.TypeOf(a))
+	}
+}
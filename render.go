@@ -44,10 +44,13 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/insionng/martini/inject"
 )
 
 const (
@@ -58,6 +61,7 @@ const (
 	ContentHTML    = "text/html"
 	ContentXHTML   = "application/xhtml+xml"
 	ContentXML     = "text/xml"
+	ContentText    = "text/plain"
 	defaultCharset = "UTF-8"
 )
 
@@ -146,9 +150,52 @@ var (
 		"current": func() (string, error) {
 			return "", nil
 		},
+		"urlfor": func(name string, pairs ...interface{}) (string, error) {
+			return "", fmt.Errorf("urlfor called without martini.Routes mapped")
+		},
 	}
 )
 
+// urlFor returns the urlfor template func, which builds the URL of a named route from key/value pairs:
+//
+//	<a href="{{urlfor "user" "id" .User.ID "tab" "posts"}}">
+//
+// Values of the route's params are put into the path, all the others make up the query string.
+func urlFor(routes Routes) func(string, ...interface{}) (string, error) {
+	return func(name string, pairs ...interface{}) (string, error) {
+		if len(pairs)%2 != 0 {
+			return "", fmt.Errorf("urlfor expects key/value pairs")
+		}
+
+		var names []string
+		for _, r := range routes.All() {
+			if r, ok := r.(*route); ok && r.name == name {
+				names = r.paramNames()
+				break
+			}
+		}
+
+		params := Params{}
+		query := url.Values{}
+		for i := 0; i < len(pairs); i += 2 {
+			key, val := fmt.Sprint(pairs[i]), fmt.Sprint(pairs[i+1])
+			if hasMethod(names, key) {
+				params[key] = val
+			} else {
+				query.Add(key, val)
+			}
+		}
+		return routes.URLForParams(name, params, query)
+	}
+}
+
+// addURLFor binds the urlfor template func to the Routes service, if there is one.
+func addURLFor(t *template.Template, c Context) {
+	if v := c.Get(inject.InterfaceOf((*Routes)(nil))); v.IsValid() {
+		t.Funcs(template.FuncMap{"urlfor": urlFor(v.Interface().(Routes))})
+	}
+}
+
 func prepareCharset(charset string) string {
 	if len(charset) != 0 {
 		return "; charset=" + charset
@@ -428,6 +475,7 @@ func Renderer(options ...RenderOptions) Handler {
 			// use a clone of the initial template
 			tc, _ = t.Clone()
 		}
+		addURLFor(tc, c)
 		//c.MapTo(&Render{res, req, tc, opt, cs, Data}, (*Render)(nil))
 		c.Map(&Render{res, req, tc, opt, cs, Data})
 	}
@@ -459,6 +507,7 @@ func Renderor(res http.ResponseWriter, req *http.Request, c Context, options ...
 
 		tc, _ = t.Clone()
 	}
+	addURLFor(tc, c)
 
 	return &Render{res, req, tc, opt, cs, Data}
 
@@ -1,6 +1,7 @@
 package martini
 
 import (
+	"bytes"
 	"encoding/xml"
 	"html/template"
 	"net/http"
@@ -541,6 +542,26 @@ func Test_Render_NoRace(t *testing.T) {
 	<-done
 }
 
+func Test_Render_URLFor(t *testing.T) {
+	router := NewRouter()
+	router.Get("/users/:id", func() {}).Name("user")
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	c := New().createContext(recorder, req)
+	c.MapTo(router, (*Routes)(nil))
+
+	tmpl := template.Must(template.New("urlfor").Funcs(helperFuncs).Parse(`<a href="{{urlfor "user" "id" 5 "tab" "a/b"}}">`))
+	addURLFor(tmpl, c)
+	buf := new(bytes.Buffer)
+	Texpect(t, tmpl.Execute(buf, nil), nil)
+	Texpect(t, buf.String(), `<a href="/users/5?tab=a%2Fb">`)
+
+	tmpl = template.Must(template.New("urlfor").Funcs(helperFuncs).Parse(`{{urlfor "nope"}}`))
+	addURLFor(tmpl, c)
+	Trefute(t, tmpl.Execute(buf, nil), nil)
+}
+
 func Test_GetExt(t *testing.T) {
 	Texpect(t, getExt("test"), "")
 	Texpect(t, getExt("test.tmpl"), ".tmpl")
@@ -0,0 +1,26 @@
+package martini
+
+import (
+	gocontext "context"
+	"net/http"
+	"reflect"
+)
+
+var requestType = reflect.TypeOf((*http.Request)(nil))
+
+// SetRequestContext replaces the context.Context of the request for the handlers that are called after the
+// caller. The mapped *http.Request is replaced with a copy that carries the new context, so that both stay in
+// sync. It returns the new request.
+//
+//	m.Use(func(c martini.Context, ctx context.Context) {
+//		ctx, cancel := context.WithTimeout(ctx, time.Second)
+//		defer cancel()
+//		martini.SetRequestContext(c, ctx)
+//		c.Next()
+//	})
+func SetRequestContext(c Context, ctx gocontext.Context) *http.Request {
+	req := c.Get(requestType).Interface().(*http.Request).WithContext(ctx)
+	c.Map(req)
+	c.MapTo(ctx, (*gocontext.Context)(nil))
+	return req
+}
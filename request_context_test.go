@@ -0,0 +1,65 @@
+package martini
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type ctxKey string
+
+func Test_RequestContext(t *testing.T) {
+	m := New()
+	m.Use(func(c Context, ctx gocontext.Context, req *http.Request) {
+		expect(t, ctx, req.Context())
+		ctx, cancel := gocontext.WithTimeout(gocontext.WithValue(ctx, ctxKey("user"), "jeremy"), time.Second)
+		defer cancel()
+		newReq := SetRequestContext(c, ctx)
+		expect(t, newReq.Context(), ctx)
+		c.Next()
+	})
+	r := NewRouter()
+	r.Get("/", func(ctx gocontext.Context, req *http.Request) string {
+		expect(t, req.Context(), ctx)
+		_, ok := ctx.Deadline()
+		expect(t, ok, true)
+		return ctx.Value(ctxKey("user")).(string)
+	})
+	m.Action(r.Handle)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	m.ServeHTTP(res, req)
+	expect(t, res.Body.String(), "jeremy")
+}
+
+func Test_RequestContext_ClientGone(t *testing.T) {
+	cancelled := make(chan struct{})
+	m := New()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Action(func(ctx gocontext.Context) {
+		select {
+		case <-ctx.Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	})
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	go http.DefaultClient.Do(req.WithContext(ctx))
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("the context of the request wasn't cancelled")
+	}
+}
@@ -1,35 +1,77 @@
 package martini
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/insionng/martini/inject"
 	"net/http"
 	"reflect"
+	"strings"
 )
 
 // ReturnHandler is a service that Martini provides that is called
 // when a route handler returns something. The ReturnHandler is
 // responsible for writing to the ResponseWriter based on the values
 // that are passed into this function.
+//
+// The default ReturnHandler writes strings and byte slices as they are.
+// Structs, maps and slices are encoded in the format the Accept header
+// prefers: JSON, XML or one added with RegisterEncoder. An io.Reader,
+// a channel of strings or byte slices and a func(io.Writer) error are
+// streamed, each write is flushed to the client right away. Streaming
+// stops when the client goes away or the server shuts down, goroutines
+// that send on a returned channel should stop once the request's
+// context is done. A leading
+// int return value is used as the status code, a lone one, as in
+// (int, error), is written as the status alone.
 type ReturnHandler func(Context, []reflect.Value)
 
 func defaultReturnHandler() ReturnHandler {
 	return func(ctx Context, vals []reflect.Value) {
 		rv := ctx.Get(inject.InterfaceOf((*http.ResponseWriter)(nil)))
 		res := rv.Interface().(http.ResponseWriter)
+		status := 0
 		var responseVal reflect.Value
-		if len(vals) > 1 && vals[0].Kind() == reflect.Int {
-			res.WriteHeader(int(vals[0].Int()))
-			responseVal = vals[1]
+		if len(vals) > 0 && vals[0].Kind() == reflect.Int {
+			status = int(vals[0].Int())
+			if len(vals) > 1 {
+				responseVal = vals[1]
+			}
 		} else if len(vals) > 0 {
 			responseVal = vals[0]
 		}
-		if canDeref(responseVal) {
+		for responseVal.Kind() == reflect.Interface && !responseVal.IsNil() {
 			responseVal = responseVal.Elem()
 		}
-		if isByteSlice(responseVal) {
-			res.Write(responseVal.Bytes())
-		} else {
-			res.Write([]byte(responseVal.String()))
+		returned := responseVal
+		for canDeref(responseVal) && !responseVal.IsNil() {
+			responseVal = responseVal.Elem()
+		}
+
+		switch {
+		case !responseVal.IsValid() || isNil(responseVal):
+			// nothing to write but the status
+			if status != 0 {
+				res.WriteHeader(status)
+			}
+		case isStream(returned):
+			stream(ctx, res, status, returned)
+		case responseVal.Kind() == reflect.String || isByteSlice(responseVal):
+			if status != 0 {
+				res.WriteHeader(status)
+			}
+			if isByteSlice(responseVal) {
+				res.Write(responseVal.Bytes())
+			} else {
+				res.Write([]byte(responseVal.String()))
+			}
+		case isEncodable(responseVal):
+			if status == 0 {
+				status = http.StatusOK
+			}
+			encodeValue(ctx, res, status, returned.Interface())
+		default:
+			handleError(ctx, fmt.Errorf("martini: can't write a return value of type %s", responseVal.Type()))
 		}
 	}
 }
@@ -41,3 +83,55 @@ func isByteSlice(val reflect.Value) bool {
 func canDeref(val reflect.Value) bool {
 	return val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr
 }
+
+func isNil(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Chan, reflect.Func:
+		return val.IsNil()
+	}
+	return false
+}
+
+func isEncodable(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
+// encodeValue writes v in the format the request accepts, with the same
+// encoders and options as the Render service.
+func encodeValue(ctx Context, res http.ResponseWriter, status int, v interface{}) {
+	req := ctx.Get(requestType).Interface().(*http.Request)
+	mediaType := negotiate(req.Header.Get("Accept"), offeredTypes())
+	if mediaType == "" {
+		handleError(ctx, NewHTTPError(http.StatusNotAcceptable,
+			"none of the accepted media types is offered: "+strings.Join(offeredTypes(), ", ")))
+		return
+	}
+
+	r := &Render{opt: prepareRenderOptions(nil), compiledCharset: prepareCharset("")}
+	if rv := ctx.Get(reflect.TypeOf(r)); rv.IsValid() {
+		copy := *rv.Interface().(*Render)
+		r = &copy
+	}
+	r.ResponseWriter = res
+
+	switch mediaType {
+	case ContentJSON:
+		r.JSON(status, v)
+	case ContentXML, "application/xml":
+		r.XML(status, v)
+	default:
+		enc, _ := encoderFor(mediaType)
+		var buf bytes.Buffer
+		if err := enc(&buf, v); err != nil {
+			handleError(ctx, err)
+			return
+		}
+		res.Header().Set(ContentType, mediaType+r.compiledCharset)
+		res.WriteHeader(status)
+		res.Write(buf.Bytes())
+	}
+}
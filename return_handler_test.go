@@ -0,0 +1,103 @@
+package martini
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type returnedUser struct {
+	ID   int    `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
+}
+
+func Test_ReturnHandlerEncodesValues(t *testing.T) {
+	defer setENV(Env)
+	setENV(Dev)
+
+	RegisterEncoder("text/csv", func(w io.Writer, v interface{}) error {
+		u := v.(*returnedUser)
+		_, err := fmt.Fprintf(w, "%d,%s\n", u.ID, u.Name)
+		return err
+	})
+
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Get("/user", func() *returnedUser {
+		return &returnedUser{1, "jeremy"}
+	})
+	m.Post("/user", func() (int, returnedUser) {
+		return http.StatusCreated, returnedUser{2, "codegangsta"}
+	})
+	m.Get("/tags", func() []string {
+		return []string{"go", "web"}
+	})
+	m.Delete("/user", func() (int, error) {
+		return http.StatusNoContent, nil
+	})
+	m.Put("/user", func() (int, error) {
+		return http.StatusNoContent, NewHTTPError(http.StatusConflict, "the user was changed")
+	})
+	m.Get("/func", func() func() {
+		return func() {}
+	})
+
+	for _, tt := range []struct {
+		method, path, accept string
+		code                 int
+		contentType, body    string
+	}{
+		{"GET", "/user", "", http.StatusOK, "application/json; charset=UTF-8", `{"id":1,"name":"jeremy"}`},
+		{"GET", "/user", "text/html, application/json;q=0.9", http.StatusOK, "application/json; charset=UTF-8", `{"id":1,"name":"jeremy"}`},
+		{"GET", "/user", "application/xml", http.StatusOK, "text/xml; charset=UTF-8", "<returnedUser><id>1</id><name>jeremy</name></returnedUser>"},
+		{"GET", "/user", "application/json;q=0.5, text/*", http.StatusOK, "text/xml; charset=UTF-8", "<returnedUser>"},
+		{"GET", "/user", "text/csv", http.StatusOK, "text/csv; charset=UTF-8", "1,jeremy\n"},
+		{"GET", "/user", "image/png", http.StatusNotAcceptable, "", "none of the accepted media types"},
+		{"POST", "/user", "*/*", http.StatusCreated, "application/json; charset=UTF-8", `{"id":2,"name":"codegangsta"}`},
+		{"DELETE", "/user", "", http.StatusNoContent, "", ""},
+		{"PUT", "/user", "", http.StatusConflict, "", "the user was changed"},
+		{"GET", "/tags", "application/json", http.StatusOK, "application/json; charset=UTF-8", `["go","web"]`},
+		{"GET", "/func", "", http.StatusInternalServerError, "", "return value of type func()"},
+	} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Accept", tt.accept)
+		m.ServeHTTP(res, req)
+		expect(t, res.Code, tt.code)
+		if tt.contentType != "" {
+			expect(t, res.Header().Get(ContentType), tt.contentType)
+		}
+		if !strings.Contains(res.Body.String(), tt.body) {
+			t.Errorf("%s %s: expected %q in %q", tt.method, tt.path, tt.body, res.Body.String())
+		}
+	}
+}
+
+func Test_ReturnHandlerUsesRenderOptions(t *testing.T) {
+	m := Classic()
+	m.Use(Renderer(RenderOptions{IndentJSON: true}))
+	m.Get("/", func() map[string]int {
+		return map[string]int{"a": 1}
+	})
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	m.ServeHTTP(res, req)
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Body.String(), "{\n  \"a\": 1\n}")
+}
+
+func Test_Negotiate(t *testing.T) {
+	offers := []string{"application/json", "text/xml", "text/csv"}
+	expect(t, negotiate("", offers), "application/json")
+	expect(t, negotiate("text/csv", offers), "text/csv")
+	expect(t, negotiate("text/*", offers), "text/xml")
+	expect(t, negotiate("text/*;q=0.5, text/csv", offers), "text/csv")
+	expect(t, negotiate("*/*, application/json;q=0", offers), "text/xml")
+	expect(t, negotiate("image/png", offers), "")
+}
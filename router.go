@@ -1,22 +1,75 @@
 package martini
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
+	"net/url"
+	"path"
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 // Params is a map of name/value pairs for named routes. An instance of martini.Params is available to be injected into any route handler.
 type Params map[string]string
 
+// Int returns the named param as an int. Returns 0 if the param is missing or not an integer.
+// Use a constrained param such as ":id<int>" to make sure routes only match valid values.
+func (p Params) Int(name string) int {
+	v, err := strconv.ParseInt(p[name], 10, 0)
+	if err != nil {
+		return 0
+	}
+	return int(v)
+}
+
+// Int64 returns the named param as an int64. Returns 0 if the param is missing or not an integer.
+func (p Params) Int64(name string) int64 {
+	v, err := strconv.ParseInt(p[name], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// Uint returns the named param as a uint. Returns 0 if the param is missing or not an unsigned integer.
+func (p Params) Uint(name string) uint {
+	v, err := strconv.ParseUint(p[name], 10, 0)
+	if err != nil {
+		return 0
+	}
+	return uint(v)
+}
+
+// Uint64 returns the named param as a uint64. Returns 0 if the param is missing or not an unsigned integer.
+func (p Params) Uint64(name string) uint64 {
+	v, err := strconv.ParseUint(p[name], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// Float64 returns the named param as a float64. Returns 0 if the param is missing or not a number.
+func (p Params) Float64(name string) float64 {
+	v, err := strconv.ParseFloat(p[name], 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
 // Router is Martini's de-facto routing interface. Supports HTTP verbs, stacked handlers, and dependency injection.
 type Router interface {
 	Routes
 
 	// Group adds a group where related routes can be added.
 	Group(string, func(Router), ...Handler)
+	// Host adds a group of routes that only match requests for the given host pattern, such as ":tenant.example.com".
+	// The host params are added to the route's Params.
+	Host(string, func(Router), ...Handler)
 	// Get adds a route for a HTTP GET request to the specified matching pattern.
 	Get(string, ...Handler) Route
 	// Patch adds a route for a HTTP PATCH request to the specified matching pattern.
@@ -33,23 +86,75 @@ type Router interface {
 	Head(string, ...Handler) Route
 	// Any adds a route for any HTTP method request to the specified matching pattern.
 	Any(string, ...Handler) Route
+	// Mount serves every request below the prefix with a *Martini, *ClassicMartini or http.Handler.
+	Mount(string, interface{})
+
+	// Middleware sets a named stack of middleware handlers. Routes, groups and other stacks can refer to the stack
+	// by passing its name in place of a handler. A stack has to be set before it is referred to.
+	Middleware(string, ...Handler)
 
 	// NotFound sets the handlers that are called when a no route matches a request. Throws a basic 404 by default.
 	NotFound(...Handler)
+	// MethodNotAllowed sets the handlers that are called when routes match the request path but not its method.
+	// The Allow header is set before they are called. Throws a basic 405 by default.
+	MethodNotAllowed(...Handler)
 
 	// Handle is the entry point for routing. This is used as a martini.Handler
 	Handle(http.ResponseWriter, *http.Request, Context)
 }
 
 type router struct {
-	routes    []*route
-	notFounds []Handler
-	groups    []group
-}
+	routes      []*route
+	tree        *routeTree
+	notFounds   []Handler
+	notAlloweds []Handler
+	groups      []group
+	middleware  map[string][]Handler
+	opt         RouterOptions
+}
+
+// RouterOptions is a struct for specifying configuration options for a martini.Router.
+type RouterOptions struct {
+	// DisableMethodNotAllowed hands requests whose path only has routes for other methods to the NotFound handlers
+	// instead of answering them with a 405.
+	DisableMethodNotAllowed bool
+	// DisableAutoOptions stops the router from answering OPTIONS requests for paths that have routes but no Options
+	// or Any route of their own.
+	DisableAutoOptions bool
+	// TrailingSlash sets how paths that only differ from a route's pattern by a trailing slash are handled.
+	// Defaults to TrailingSlashLenient.
+	TrailingSlash TrailingSlash
+	// CleanPath redirects requests for paths with repeated slashes or "." and ".." elements to the cleaned path
+	// when a route matches it.
+	CleanPath bool
+	// RedirectFixedCase redirects requests to the path of a route that matches them case-insensitively.
+	RedirectFixedCase bool
+	// RedirectStatus is the status code of the redirects to canonical paths.
+	// Defaults to 301 for GET and HEAD requests and to 308 for other methods, which keeps their method and body.
+	RedirectStatus int
+	// URLScheme is the scheme of the URLs URLFor and URLForParams build for routes added with Router.Host, such
+	// as "https". Without it, those URLs start with "//", which only works relative to a page, not in emails or
+	// API responses.
+	URLScheme string
+}
+
+// TrailingSlash is a policy for paths that only differ from a route's pattern by a trailing slash.
+type TrailingSlash int
+
+const (
+	// TrailingSlashLenient lets routes match their path with or without a trailing slash.
+	TrailingSlashLenient TrailingSlash = iota
+	// TrailingSlashStrict only lets routes match their path as it is written in their pattern.
+	TrailingSlashStrict
+	// TrailingSlashRedirect matches like TrailingSlashStrict, but redirects requests to the path with or without
+	// the trailing slash when a route matches that.
+	TrailingSlashRedirect
+)
 
 type group struct {
 	pattern  string
 	handlers []Handler
+	host     string
 }
 
 // NewRouter creates a new Router instance.
@@ -61,12 +166,38 @@ type group struct {
 //	m.MapTo(r, (*martini.Routes)(nil))
 //
 // If you are using ClassicMartini, then this is done for you.
-func NewRouter() Router {
-	return &router{notFounds: []Handler{http.NotFound}, groups: make([]group, 0)}
+//
+// An optional RouterOptions struct can be passed to configure the router.
+func NewRouter(options ...RouterOptions) Router {
+	var opt RouterOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	tree := newRouteTree()
+	tree.strict = opt.TrailingSlash != TrailingSlashLenient
+	return &router{
+		tree:        tree,
+		notFounds:   []Handler{http.NotFound},
+		notAlloweds: []Handler{methodNotAllowed},
+		groups:      make([]group, 0),
+		middleware:  make(map[string][]Handler),
+		opt:         opt,
+	}
+}
+
+func methodNotAllowed(res http.ResponseWriter) {
+	http.Error(res, "405 method not allowed", http.StatusMethodNotAllowed)
 }
 
 func (r *router) Group(pattern string, fn func(Router), h ...Handler) {
-	r.groups = append(r.groups, group{pattern, h})
+	r.groups = append(r.groups, group{pattern, h, ""})
+	fn(r)
+	r.groups = r.groups[:len(r.groups)-1]
+}
+
+func (r *router) Host(host string, fn func(Router), h ...Handler) {
+	r.groups = append(r.groups, group{"", h, host})
 	fn(r)
 	r.groups = r.groups[:len(r.groups)-1]
 }
@@ -104,43 +235,227 @@ func (r *router) Any(pattern string, h ...Handler) Route {
 }
 
 func (r *router) Handle(res http.ResponseWriter, req *http.Request, context Context) {
-	for _, route := range r.routes {
-		ok, vals := route.Match(req.Method, req.URL.Path)
-		if ok {
-			params := Params(vals)
-			context.Map(params)
-			route.Handle(context, res)
+	if route, params := r.tree.lookup(req.Method, req.Host, req.URL.Path); route != nil {
+		// keep the params of the route this app is mounted on
+		if v := context.Get(reflect.TypeOf(params)); v.IsValid() {
+			for k, val := range v.Interface().(Params) {
+				if _, ok := params[k]; !ok {
+					params[k] = val
+				}
+			}
+		}
+		context.Map(params)
+		route.Handle(context, res)
+		return
+	}
+
+	handlers := r.notFounds
+	allowed := r.allowedMethods(req)
+	if len(allowed) == 0 {
+		if p, ok := r.canonicalPath(req); ok {
+			r.redirect(res, req, p)
 			return
 		}
 	}
+	if len(allowed) > 0 {
+		switch {
+		case req.Method == "OPTIONS" && !r.opt.DisableAutoOptions:
+			// no OPTIONS route exists, answer with the allowed methods
+			res.Header().Set("Allow", strings.Join(allowed, ","))
+			res.WriteHeader(http.StatusOK)
+			return
+		case !r.opt.DisableMethodNotAllowed:
+			// routes for other methods exist, 405
+			res.Header().Set("Allow", strings.Join(allowed, ","))
+			handlers = r.notAlloweds
+		}
+	}
 
 	// no routes exist, 404
-	c := &routeContext{context, 0, r.notFounds}
+	c := &routeContext{context, 0, handlers}
 	context.MapTo(c, (*Context)(nil))
 	c.run()
 }
 
+// canonicalPath returns the path to redirect the request to when the router's options ask for redirects and
+// a route matches that path.
+func (r *router) canonicalPath(req *http.Request) (string, bool) {
+	p := req.URL.Path
+	var candidates []string
+	if r.opt.CleanPath {
+		if p = cleanPath(p); p != req.URL.Path {
+			candidates = append(candidates, p)
+		}
+	}
+	if r.opt.TrailingSlash == TrailingSlashRedirect && p != "/" {
+		if strings.HasSuffix(p, "/") {
+			candidates = append(candidates, strings.TrimSuffix(p, "/"))
+		} else {
+			candidates = append(candidates, p+"/")
+		}
+	}
+
+	for _, c := range candidates {
+		if len(r.tree.matchAll(req.Host, c, true)) > 0 {
+			return c, true
+		}
+	}
+	if r.opt.RedirectFixedCase {
+		for _, c := range append([]string{p}, candidates...) {
+			if fixed, ok := r.fixCase(req.Host, c); ok && fixed != req.URL.Path {
+				return fixed, true
+			}
+		}
+	}
+	return "", false
+}
+
+// fixCase returns the path as the first route that matches it case-insensitively spells it.
+func (r *router) fixCase(host, p string) (string, bool) {
+	for _, route := range r.routes {
+		if route.fold == nil || route.host != nil && !route.host.regex.MatchString(stripPort(host)) {
+			continue
+		}
+		params, ok := matchRegexp(route.fold, p)
+		if !ok {
+			continue
+		}
+		fixed, err := route.buildPath(params)
+		if err != nil {
+			continue
+		}
+		if fixed, err = url.PathUnescape(fixed); err == nil && len(r.tree.matchAll(host, fixed, true)) > 0 {
+			return fixed, true
+		}
+	}
+	return "", false
+}
+
+func (r *router) redirect(res http.ResponseWriter, req *http.Request, p string) {
+	status := r.opt.RedirectStatus
+	if status == 0 {
+		status = http.StatusMovedPermanently
+		if req.Method != "GET" && req.Method != "HEAD" {
+			status = http.StatusPermanentRedirect
+		}
+	}
+
+	p = mountPrefix(req) + p
+	if strings.HasPrefix(p, "//") {
+		// a Location starting with // is another host's
+		p = "/" + strings.TrimLeft(p, "/")
+	}
+	u := url.URL{Path: p, RawQuery: req.URL.RawQuery}
+	res.Header().Set("Location", u.String())
+	res.WriteHeader(status)
+}
+
+// cleanPath returns the shortest path equivalent to p, keeping its trailing slash.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// mountPrefix returns the part of the requested path that was stripped before the request was handed to the
+// router of a mounted app.
+func mountPrefix(req *http.Request) string {
+	u, err := url.ParseRequestURI(req.RequestURI)
+	if err != nil || !strings.HasSuffix(u.Path, req.URL.Path) {
+		return ""
+	}
+	return u.Path[:len(u.Path)-len(req.URL.Path)]
+}
+
+func (r *router) Middleware(name string, handlers ...Handler) {
+	handlers = r.expand(handlers)
+	for _, handler := range handlers {
+		validateHandler(handler)
+	}
+	r.middleware[name] = handlers
+}
+
+// expand replaces the names of middleware stacks in the handlers with the handlers of the stacks.
+func (r *router) expand(handlers []Handler) []Handler {
+	expanded := make([]Handler, 0, len(handlers))
+	for _, handler := range handlers {
+		name, ok := handler.(string)
+		if !ok {
+			expanded = append(expanded, handler)
+			continue
+		}
+		stack, ok := r.middleware[name]
+		if !ok {
+			panic("martini: unknown middleware " + strconv.Quote(name))
+		}
+		expanded = append(expanded, stack...)
+	}
+	return expanded
+}
+
 func (r *router) NotFound(handler ...Handler) {
 	r.notFounds = handler
 }
 
+func (r *router) MethodNotAllowed(handler ...Handler) {
+	r.notAlloweds = handler
+}
+
+// allowedMethods returns the methods the request's URL can be requested with, for use in an Allow header.
+func (r *router) allowedMethods(req *http.Request) []string {
+	methods := routeMethods(r.tree.matchAll(req.Host, req.URL.Path, true))
+	if len(methods) == 0 {
+		return methods
+	}
+	// GET routes answer HEAD requests as well
+	if hasMethod(methods, "GET") && !hasMethod(methods, "HEAD") {
+		methods = append(methods, "HEAD")
+	}
+	if !r.opt.DisableAutoOptions && !hasMethod(methods, "OPTIONS") {
+		methods = append(methods, "OPTIONS")
+	}
+	return methods
+}
+
 func (r *router) addRoute(method string, pattern string, handlers []Handler) *route {
+	host := ""
+	h := make([]Handler, 0)
 	if len(r.groups) > 0 {
 		groupPattern := ""
-		h := make([]Handler, 0)
 		for _, g := range r.groups {
 			groupPattern += g.pattern
-			h = append(h, g.handlers...)
+			h = append(h, r.expand(g.handlers)...)
+			if g.host != "" {
+				host = g.host
+			}
 		}
 
 		pattern = groupPattern + pattern
-		h = append(h, handlers...)
-		handlers = h
 	}
+	groupHandlers := len(h)
+	handlers = append(h, r.expand(handlers)...)
 
 	route := newRoute(method, pattern, handlers)
+	route.router = r
+	route.middleware = groupHandlers
+	if host != "" {
+		route.host = newHostPattern(host)
+	}
+	if r.opt.RedirectFixedCase {
+		re := route.expr
+		if !r.tree.strict {
+			re += `\/?`
+		}
+		route.fold = anchoredRegexp(`(?i)` + re)
+	}
 	route.Validate()
 	r.routes = append(r.routes, route)
+	r.tree.add(route)
 	return route
 }
 
@@ -166,21 +481,52 @@ type Route interface {
 	Pattern() string
 	// Method returns the method of the route.
 	Method() string
+	// Host returns the host pattern of the route, or "" if the route matches any host.
+	Host() string
+	// Use adds middleware handlers that are called after the handlers of the route's groups and before the
+	// handlers the route was added with. Names of the router's middleware stacks can be used as well.
+	Use(...Handler) Route
+	// Handlers returns the complete chain of handlers that is called for the route.
+	Handlers() []Handler
+	// Doc sets the description of the route used in OpenAPI documents.
+	Doc(APIDoc) Route
+	// GetDoc returns the description of the route.
+	GetDoc() APIDoc
+	// Meta sets a metadata value on the route, such as tags, auth scopes or a rate limit class.
+	// Middleware can read it from the martini.Route that is injected for the matched route.
+	Meta(key string, value interface{}) Route
+	// GetMeta returns the metadata value for the key, or nil if it isn't set.
+	GetMeta(key string) interface{}
+	// Metadata returns a copy of all the metadata of the route.
+	Metadata() map[string]interface{}
 }
 
 type route struct {
-	method   string
-	regex    *regexp.Regexp
+	method string
+	regex  *regexp.Regexp
+	// expr is the route's regexp without the optional trailing slash and the anchors.
+	expr string
+	// strict and fold are the route's regexp without the optional trailing slash and case-insensitive.
+	// They are only compiled when the router's options need them.
+	strict   *regexp.Regexp
+	fold     *regexp.Regexp
 	handlers []Handler
 	pattern  string
 	name     string
+	host     *hostPattern
+	router   *router
+	doc      APIDoc
+	meta     map[string]interface{}
+	// middleware is the position in handlers where Use adds middleware.
+	middleware int
 }
 
 func newRoute(method string, pattern string, handlers []Handler) *route {
-	route := route{method, nil, handlers, pattern, ""}
-	r := regexp.MustCompile(`:[^/#?()\.\\]+`)
+	route := route{method: method, handlers: handlers, pattern: pattern}
+	r := regexp.MustCompile(`:[^/#?()\.\\<]+(<[^>]*>)?`)
 	pattern = r.ReplaceAllStringFunc(pattern, func(m string) string {
-		return fmt.Sprintf(`(?P<%s>[^/#?]+)`, m[1:])
+		name, constraint := splitParam(m[1:])
+		return fmt.Sprintf(`(?P<%s>%s)`, name, constraint)
 	})
 	r2 := regexp.MustCompile(`\*\*`)
 	var index int
@@ -188,11 +534,43 @@ func newRoute(method string, pattern string, handlers []Handler) *route {
 		index++
 		return fmt.Sprintf(`(?P<_%d>[^#?]*)`, index)
 	})
-	pattern += `\/?`
-	route.regex = regexp.MustCompile(pattern)
+	route.expr = pattern
+	route.regex = anchoredRegexp(pattern + `\/?`)
 	return &route
 }
 
+// anchoredRegexp compiles the regexp of a route so it only matches whole paths. Without the anchors, a
+// constraint like a|ab would match the shorter alternative and miss the path /ab.
+func anchoredRegexp(expr string) *regexp.Regexp {
+	return regexp.MustCompile(`^(?:` + expr + `)$`)
+}
+
+// paramRegexp is what a :param without a constraint matches.
+const paramRegexp = `[^/#?]+`
+
+// paramConstraints are the named constraints that can be used in patterns such as "/users/:id<int>".
+var paramConstraints = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// splitParam splits a param like id<int> into its name and the regexp its value has to match.
+// Constraints that aren't one of the paramConstraints are used as a regexp as they are.
+func splitParam(param string) (name string, constraint string) {
+	i := strings.IndexByte(param, '<')
+	if i < 0 || param[len(param)-1] != '>' {
+		return param, paramRegexp
+	}
+
+	name, constraint = param[:i], param[i+1:len(param)-1]
+	if c, ok := paramConstraints[constraint]; ok {
+		constraint = c
+	}
+	return name, constraint
+}
+
 func (r route) MatchMethod(method string) bool {
 	return r.method == "*" || method == r.method || (method == "HEAD" && r.method == "GET")
 }
@@ -203,17 +581,28 @@ func (r route) Match(method string, path string) (bool, map[string]string) {
 		return false, nil
 	}
 
-	matches := r.regex.FindStringSubmatch(path)
+	params, ok := r.matchPath(path)
+	return ok, params
+}
+
+// matchPath matches the path against the route's regexp, whatever the method.
+func (r route) matchPath(path string) (Params, bool) {
+	return matchRegexp(r.regex, path)
+}
+
+// matchRegexp matches the whole path against a route regexp and returns the named groups as params.
+func matchRegexp(re *regexp.Regexp, path string) (Params, bool) {
+	matches := re.FindStringSubmatch(path)
 	if len(matches) > 0 && matches[0] == path {
-		params := make(map[string]string)
-		for i, name := range r.regex.SubexpNames() {
+		params := make(Params)
+		for i, name := range re.SubexpNames() {
 			if len(name) > 0 {
 				params[name] = matches[i]
 			}
 		}
-		return true, params
+		return params, true
 	}
-	return false, nil
+	return nil, false
 }
 
 func (r *route) Validate() {
@@ -232,7 +621,7 @@ func (r *route) Handle(c Context, res http.ResponseWriter) {
 // URLWith returns the url pattern replacing the parameters for its values
 func (r *route) URLWith(args []string) string {
 	if len(args) > 0 {
-		reg := regexp.MustCompile(`:[^/#?()\.\\]+|\(\?P<[a-zA-Z0-9]+>.*\)`)
+		reg := regexp.MustCompile(`:[^/#?()\.\\<]+(<[^>]*>)?|\(\?P<[a-zA-Z0-9]+>.*\)`)
 		argCount := len(args)
 		i := 0
 		url := reg.ReplaceAllStringFunc(r.pattern, func(m string) string {
@@ -251,6 +640,145 @@ func (r *route) URLWith(args []string) string {
 	return r.pattern
 }
 
+// build returns the url of the route with the named params filled in.
+func (r *route) build(params Params) (string, error) {
+	if r.host == nil {
+		return r.buildPath(params)
+	}
+
+	host, err := r.host.build(params)
+	if err != nil {
+		return "", err
+	}
+	p, err := r.buildPath(params)
+	if err != nil {
+		return "", err
+	}
+	return r.hostURL(host, p), nil
+}
+
+// hostURL returns the URL of the path on the host, with the URLScheme of the router if it has one.
+func (r *route) hostURL(host, path string) string {
+	if r.router != nil && r.router.opt.URLScheme != "" {
+		return r.router.opt.URLScheme + "://" + host + path
+	}
+	return "//" + host + path
+}
+
+// buildPath returns the path of the route with the named params filled in.
+func (r *route) buildPath(params Params) (string, error) {
+	var buf bytes.Buffer
+	err := walkPattern(r.pattern, func(literal string) {
+		buf.WriteString(literal)
+	}, func(name, constraint string, wildcard bool) error {
+		v, err := r.paramValue(params, name, constraint)
+		if err != nil {
+			return err
+		}
+		if !wildcard {
+			buf.WriteString(url.PathEscape(v))
+			return nil
+		}
+		// wildcards span several segments
+		segments := strings.Split(v, "/")
+		for i := range segments {
+			segments[i] = url.PathEscape(segments[i])
+		}
+		buf.WriteString(strings.Join(segments, "/"))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// walkPattern calls literal for the literal parts of a route pattern and param for its :params, ** wildcards
+// and named regexp groups. It fails for patterns that contain any other regexp syntax.
+func walkPattern(p string, literal func(string), param func(name, constraint string, wildcard bool) error) error {
+	wildcards := 0
+	for i := 0; i < len(p); {
+		c := p[i]
+		switch {
+		case c == ':' && i+1 < len(p) && isParamNameChar(p[i+1]):
+			j := paramEnd(p, i)
+			name, constraint := splitParam(p[i+1 : j])
+			if err := param(name, constraint, false); err != nil {
+				return err
+			}
+			i = j
+		case c == '*' && i+1 < len(p) && p[i+1] == '*':
+			wildcards++
+			if err := param("_"+strconv.Itoa(wildcards), `[^#?]*`, true); err != nil {
+				return err
+			}
+			i += 2
+		case strings.HasPrefix(p[i:], "(?P<"):
+			end := groupEnd(p, i)
+			gt := strings.IndexByte(p[i:], '>')
+			if end < 0 || gt < 0 {
+				return fmt.Errorf("martini: can't build a URL for the pattern %q", p)
+			}
+			if err := param(p[i+4:i+gt], p[i+gt+1:end-1], false); err != nil {
+				return err
+			}
+			i = end
+		case c == '\\' && i+1 < len(p):
+			literal(p[i+1 : i+2])
+			i += 2
+		case strings.IndexByte(regexpMeta, c) >= 0:
+			return fmt.Errorf("martini: can't build a URL for the pattern %q", p)
+		default:
+			j := i + 1
+			for j < len(p) && p[j] != ':' && p[j] != '*' && strings.IndexByte(regexpMeta, p[j]) < 0 {
+				j++
+			}
+			literal(p[i:j])
+			i = j
+		}
+	}
+	return nil
+}
+
+func (r *route) paramValue(params Params, name, constraint string) (string, error) {
+	v, ok := params[name]
+	if !ok {
+		return "", fmt.Errorf("martini: missing param %q for the route %q", name, r.pattern)
+	}
+	if ok, _ := regexp.MatchString(`^(?:`+constraint+`)$`, v); !ok {
+		return "", fmt.Errorf("martini: param %q doesn't match %q for the route %q", name, constraint, r.pattern)
+	}
+	return v, nil
+}
+
+// groupEnd returns the end of the regexp group starting at i in the pattern, or -1.
+func groupEnd(pattern string, i int) int {
+	depth := 0
+	for ; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// paramNames returns the names of the params in the route's host and path.
+func (r *route) paramNames() []string {
+	var names []string
+	if r.host != nil {
+		names = append(names, r.host.regex.SubexpNames()...)
+	}
+	return append(names, r.regex.SubexpNames()...)
+}
+
 func (r *route) Name(name string) {
 	r.name = name
 }
@@ -267,10 +795,73 @@ func (r *route) Method() string {
 	return r.method
 }
 
+func (r *route) Use(handlers ...Handler) Route {
+	if r.router != nil {
+		handlers = r.router.expand(handlers)
+	}
+	for _, handler := range handlers {
+		validateHandler(handler)
+	}
+
+	h := make([]Handler, 0, len(r.handlers)+len(handlers))
+	h = append(h, r.handlers[:r.middleware]...)
+	h = append(h, handlers...)
+	h = append(h, r.handlers[r.middleware:]...)
+	r.handlers = h
+	r.middleware += len(handlers)
+	return r
+}
+
+func (r *route) Handlers() []Handler {
+	return append([]Handler(nil), r.handlers...)
+}
+
+func (r *route) Doc(doc APIDoc) Route {
+	r.doc = doc
+	return r
+}
+
+func (r *route) GetDoc() APIDoc {
+	return r.doc
+}
+
+func (r *route) Meta(key string, value interface{}) Route {
+	if r.meta == nil {
+		r.meta = make(map[string]interface{})
+	}
+	r.meta[key] = value
+	return r
+}
+
+func (r *route) GetMeta(key string) interface{} {
+	return r.meta[key]
+}
+
+func (r *route) Metadata() map[string]interface{} {
+	meta := make(map[string]interface{}, len(r.meta))
+	for k, v := range r.meta {
+		meta[k] = v
+	}
+	return meta
+}
+
+func (r *route) Host() string {
+	if r.host == nil {
+		return ""
+	}
+	return r.host.pattern
+}
+
 // Routes is a helper service for Martini's routing layer.
 type Routes interface {
 	// URLFor returns a rendered URL for the given route. Optional params can be passed to fulfill named parameters in the route.
+	// The URL of a route added with Router.Host starts with its host, the params of the host pattern come first.
+	// It is scheme-relative, starting with "//", unless the router has a RouterOptions.URLScheme.
 	URLFor(name string, params ...interface{}) string
+	// URLForParams returns the URL for the given route, filling in the named params (_1, _2, ... for ** wildcards)
+	// and adding the query. Param values are escaped and have to match their constraints. URLs of host routes
+	// start with "//" like the ones of URLFor, unless the router has a RouterOptions.URLScheme.
+	URLForParams(name string, params Params, query url.Values) (string, error)
 	// MethodsFor returns an array of methods available for the path
 	MethodsFor(path string) []string
 	// All returns an array with all the routes in the router.
@@ -299,9 +890,33 @@ func (r *router) URLFor(name string, params ...interface{}) string {
 		}
 	}
 
+	if route.host != nil {
+		n := route.host.NumParams()
+		if n > len(args) {
+			n = len(args)
+		}
+		return route.hostURL(route.host.URLWith(args[:n]), route.URLWith(args[n:]))
+	}
 	return route.URLWith(args)
 }
 
+// URLForParams returns the url for the given route name with the named params and the query.
+func (r *router) URLForParams(name string, params Params, query url.Values) (string, error) {
+	route := r.findRoute(name)
+	if route == nil {
+		return "", fmt.Errorf("martini: route %q not found", name)
+	}
+
+	u, err := route.build(params)
+	if err != nil {
+		return "", err
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u, nil
+}
+
 func (r *router) All() []Route {
 	var ri = make([]Route, len(r.routes))
 
@@ -323,10 +938,13 @@ func hasMethod(methods []string, method string) bool {
 
 // MethodsFor returns all methods available for path
 func (r *router) MethodsFor(path string) []string {
+	return routeMethods(r.tree.matchAll("", path, false))
+}
+
+func routeMethods(routes []*route) []string {
 	methods := []string{}
-	for _, route := range r.routes {
-		matches := route.regex.FindStringSubmatch(path)
-		if len(matches) > 0 && matches[0] == path && !hasMethod(methods, route.method) {
+	for _, route := range routes {
+		if !hasMethod(methods, route.method) {
 			methods = append(methods, route.method)
 		}
 	}
@@ -353,6 +971,14 @@ func (r *routeContext) run() {
 		}
 		r.index += 1
 
+		vals, err = returnedError(vals)
+		if err != nil {
+			handleError(r, err)
+			// skip the rest of the handlers
+			r.index = len(r.handlers)
+			return
+		}
+
 		// if the handler returned something, write it to the http response
 		if len(vals) > 0 {
 			ev := r.Get(reflect.TypeOf(ReturnHandler(nil)))
@@ -3,6 +3,7 @@ package martini
 import (
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 )
@@ -251,8 +252,151 @@ func Test_RouteMatching(t *testing.T) {
 	}
 }
 
-func Test_MethodsFor(t *testing.T) {
+func Test_ConstrainedParams(t *testing.T) {
+	router := NewRouter()
+	result := ""
+	router.Get("/users/:id<int>", func(params Params) {
+		expect(t, params.Int("id"), -42)
+		expect(t, params.Int64("id"), int64(-42))
+		result += "int"
+	})
+	router.Get("/users/:id<uuid>", func(params Params) {
+		expect(t, params["id"], "6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+		result += "uuid"
+	})
+	router.Get("/users/:name<alpha>", func(params Params) {
+		expect(t, params.Int("name"), 0)
+		result += "alpha"
+	})
+	router.Get("/posts/:id<uint>/:slug<[a-z-]+>", func(params Params) {
+		expect(t, params.Uint("id"), uint(7))
+		expect(t, params["slug"], "hello-world")
+		result += "slug"
+	})
+
+	for _, path := range []string{
+		"/users/-42",
+		"/users/6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		"/users/jeremy",
+		"/users/jeremy42",
+		"/posts/7/hello-world",
+		"/posts/-7/hello-world",
+		"/posts/7/Hello",
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:9000"+path, nil)
+		context := New().createContext(recorder, req)
+		router.Handle(recorder, req, context)
+	}
+	expect(t, result, "intuuidalphaslug")
+
+	route := newRoute("GET", "/posts/:id<uint>/:slug<[a-z-]+>", nil)
+	expect(t, route.URLWith([]string{"7", "hello"}), "/posts/7/hello")
+	// the whole path has to match, whichever alternative comes first
+	ok, params := newRoute("GET", "/:x<a|ab>", nil).Match("GET", "/ab")
+	expect(t, ok, true)
+	expect(t, params["x"], "ab")
+}
+
+func Test_ParamsConversion(t *testing.T) {
+	params := Params{"int": "12", "neg": "-3", "float": "1.5", "word": "nope", "huge": "99999999999999999999"}
+	expect(t, params.Int("int"), 12)
+	expect(t, params.Int("neg"), -3)
+	expect(t, params.Uint("neg"), uint(0))
+	expect(t, params.Uint64("int"), uint64(12))
+	expect(t, params.Float64("float"), 1.5)
+	expect(t, params.Int("word"), 0)
+	expect(t, params.Int("missing"), 0)
+	expect(t, params.Int64("huge"), int64(0))
+}
+
+func Test_HostRouting(t *testing.T) {
+	router := NewRouter()
+	result := ""
+	router.Host("api.example.com", func(r Router) {
+		r.Get("/users", func() {
+			result += "api"
+		})
+	})
+	router.Host(":tenant.example.com", func(r Router) {
+		r.Group("/users", func(r Router) {
+			r.Get("/:id", func(params Params) {
+				expect(t, params["tenant"], "acme")
+				expect(t, params["id"], "5")
+				result += "tenant"
+			}).Name("tenant_user")
+		})
+	}, func() {
+		result += "host"
+	})
+	router.Get("/users", func() {
+		result += "users"
+	})
+
+	for _, url := range []string{
+		"http://api.example.com/users",
+		"http://API.example.com:8080/users",
+		"http://acme.example.com/users/5",
+		"http://localhost/users",
+		"http://example.com/users/5",
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		context := New().createContext(recorder, req)
+		router.Handle(recorder, req, context)
+		if url == "http://example.com/users/5" {
+			expect(t, recorder.Code, http.StatusNotFound)
+		}
+	}
+	expect(t, result, "apiapihosttenantusers")
+
+	expect(t, router.URLFor("tenant_user", "acme", 5), "//acme.example.com/users/5")
+	expect(t, router.All()[1].Host(), ":tenant.example.com")
+	expect(t, router.All()[2].Host(), "")
+}
+
+func Test_RouteUse(t *testing.T) {
 	router := NewRouter()
+	result := ""
+	router.Middleware("auth", func() {
+		result += "auth"
+	})
+	router.Middleware("admin", "auth", func() {
+		result += "admin"
+	})
+
+	router.Group("/admin", func(r Router) {
+		r.Get("/users", func() {
+			result += "users"
+		}).Use(func() {
+			result += "use"
+		}).Use("auth")
+	}, "admin")
+	router.Get("/posts", "auth", func() {
+		result += "posts"
+	})
+
+	for _, path := range []string{"/admin/users", "/posts"} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:9000"+path, nil)
+		context := New().createContext(recorder, req)
+		router.Handle(recorder, req, context)
+	}
+	expect(t, result, "authadminuseauthusersauthposts")
+
+	expect(t, len(router.All()[0].Handlers()), 5)
+	expect(t, len(router.All()[1].Handlers()), 2)
+}
+
+func Test_UnknownMiddleware(t *testing.T) {
+	defer func() {
+		expect(t, recover(), `martini: unknown middleware "nope"`)
+	}()
+	NewRouter().Get("/", "nope", func() {})
+}
+
+func Test_MethodsFor(t *testing.T) {
+	router := NewRouter(RouterOptions{DisableMethodNotAllowed: true})
 	recorder := httptest.NewRecorder()
 
 	req, _ := http.NewRequest("POST", "http://localhost:9000/foo", nil)
@@ -282,6 +426,164 @@ func Test_MethodsFor(t *testing.T) {
 	expect(t, recorder.Header().Get("Allow"), "GET,PUT")
 }
 
+func Test_MethodNotAllowed(t *testing.T) {
+	router := NewRouter()
+	router.Get("/foo", func() {})
+	router.Put("/foo", func() {})
+	router.Post("/foo/bar", func() {})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "http://localhost:9000/foo", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusMethodNotAllowed)
+	expect(t, recorder.Header().Get("Allow"), "GET,PUT,HEAD,OPTIONS")
+	expect(t, recorder.Body.String(), "405 method not allowed\n")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "http://localhost:9000/bar", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusNotFound)
+	expect(t, recorder.Header().Get("Allow"), "")
+}
+
+func Test_MethodNotAllowedHandler(t *testing.T) {
+	router := NewRouter()
+	router.Post("/foo", func() {})
+	router.MethodNotAllowed(func(res http.ResponseWriter) (int, string) {
+		return http.StatusMethodNotAllowed, "use " + res.Header().Get("Allow")
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:9000/foo", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusMethodNotAllowed)
+	expect(t, recorder.Body.String(), "use POST,OPTIONS")
+}
+
+func Test_AutoOptions(t *testing.T) {
+	router := NewRouter()
+	result := ""
+	router.Group("/api", func(r Router) {
+		r.Get("/users/:id", func() {})
+		r.Delete("/users/:id", func() {})
+		r.Options("/posts", func() {
+			result += "posts"
+		})
+		r.Get("/posts", func() {})
+		r.Any("/any", func(req *http.Request) {
+			result += req.Method
+		})
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "http://localhost:9000/api/users/7", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Header().Get("Allow"), "GET,DELETE,HEAD,OPTIONS")
+	expect(t, recorder.Body.Len(), 0)
+
+	// explicit OPTIONS and Any routes are still used
+	for _, path := range []string{"/api/posts", "/api/any"} {
+		recorder = httptest.NewRecorder()
+		req, _ = http.NewRequest("OPTIONS", "http://localhost:9000"+path, nil)
+		context = New().createContext(recorder, req)
+		router.Handle(recorder, req, context)
+		expect(t, recorder.Header().Get("Allow"), "")
+	}
+	expect(t, result, "postsOPTIONS")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("OPTIONS", "http://localhost:9000/api/nope", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusNotFound)
+}
+
+func Test_AutoOptionsDisabled(t *testing.T) {
+	router := NewRouter(RouterOptions{DisableAutoOptions: true})
+	router.Get("/foo", func() {})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "http://localhost:9000/foo", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusMethodNotAllowed)
+	expect(t, recorder.Header().Get("Allow"), "GET,HEAD")
+}
+
+func Test_TrailingSlashStrict(t *testing.T) {
+	router := NewRouter(RouterOptions{TrailingSlash: TrailingSlashStrict})
+	router.Get("/users", func() {})
+	router.Get("/posts/", func() {})
+	router.Get("/colou?r", func() {})
+
+	for path, code := range map[string]int{
+		"/users": http.StatusOK, "/users/": http.StatusNotFound,
+		"/posts/": http.StatusOK, "/posts": http.StatusNotFound,
+		"/color": http.StatusOK, "/colour/": http.StatusNotFound,
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:9000"+path, nil)
+		router.Handle(recorder, req, New().createContext(recorder, req))
+		expect(t, recorder.Code, code)
+	}
+}
+
+func Test_TrailingSlashRedirect(t *testing.T) {
+	router := NewRouter(RouterOptions{TrailingSlash: TrailingSlashRedirect, CleanPath: true, RedirectFixedCase: true})
+	router.Get("/users", func() {})
+	router.Post("/posts/", func() {})
+	router.Get("/users/:id<int>/Profile", func() {})
+	router.Get("/tags/:tag<a|ab>/Edit", func() {})
+
+	for _, tt := range []struct {
+		method, path string
+		code         int
+		location     string
+	}{
+		{"GET", "/users", http.StatusOK, ""},
+		{"GET", "/users/?page=2", http.StatusMovedPermanently, "/users?page=2"},
+		{"POST", "/posts", http.StatusPermanentRedirect, "/posts/"},
+		{"GET", "//a/../users", http.StatusMovedPermanently, "/users"},
+		{"GET", "/USERS/", http.StatusMovedPermanently, "/users"},
+		{"GET", "/users/5/profile", http.StatusMovedPermanently, "/users/5/Profile"},
+		{"GET", "/users/x/profile", http.StatusNotFound, ""},
+		{"GET", "/tags/ab/edit/", http.StatusMovedPermanently, "/tags/ab/Edit"},
+		{"GET", "/posts/", http.StatusMethodNotAllowed, ""},
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, "http://localhost:9000"+tt.path, nil)
+		router.Handle(recorder, req, New().createContext(recorder, req))
+		expect(t, recorder.Code, tt.code)
+		expect(t, recorder.Header().Get("Location"), tt.location)
+	}
+}
+
+func Test_RedirectStaysOnHost(t *testing.T) {
+	for _, tt := range []struct {
+		opt      RouterOptions
+		path     string
+		location string
+	}{
+		{RouterOptions{TrailingSlash: TrailingSlashRedirect}, "//evil.com/edit/", "/evil.com/edit"},
+		{RouterOptions{RedirectFixedCase: true}, "//evil.com/EDIT", "/evil.com/edit"},
+		{RouterOptions{RedirectFixedCase: true}, "///evil.com/EDIT", "/evil.com/edit"},
+	} {
+		router := NewRouter(tt.opt)
+		router.Get("/**/edit", func() {})
+
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:9000"+tt.path, nil)
+		router.Handle(recorder, req, New().createContext(recorder, req))
+		expect(t, recorder.Code, http.StatusMovedPermanently)
+		expect(t, recorder.Header().Get("Location"), tt.location)
+	}
+}
+
 func Test_NotFound(t *testing.T) {
 	router := NewRouter()
 	recorder := httptest.NewRecorder()
@@ -426,6 +728,60 @@ func Test_URLFor(t *testing.T) {
 	router.Handle(recorder, req, context)
 }
 
+func Test_URLForParams(t *testing.T) {
+	router := NewRouter()
+	router.Get("/users/:id<int>/:name", func() {}).Name("user")
+	router.Get("/files/**", func() {}).Name("files")
+	router.Get("/baz/(?P<name>[a-z]*)\\.json", func() {}).Name("baz")
+	router.Get("/colou?r", func() {}).Name("color")
+	router.Host(":tenant.example.com", func(r Router) {
+		r.Get("/", func() {}).Name("home")
+	})
+
+	u, err := router.URLForParams("user", Params{"id": "5", "name": "jo hn%"}, url.Values{"tab": {"a&b"}})
+	expect(t, err, nil)
+	expect(t, u, "/users/5/jo%20hn%25?tab=a%26b")
+
+	u, err = router.URLForParams("files", Params{"_1": "css/my app.css"}, nil)
+	expect(t, err, nil)
+	expect(t, u, "/files/css/my%20app.css")
+
+	u, err = router.URLForParams("baz", Params{"name": "john"}, nil)
+	expect(t, err, nil)
+	expect(t, u, "/baz/john.json")
+
+	u, err = router.URLForParams("home", Params{"tenant": "acme"}, nil)
+	expect(t, err, nil)
+	expect(t, u, "//acme.example.com/")
+
+	secure := NewRouter(RouterOptions{URLScheme: "https"})
+	secure.Host(":tenant.example.com", func(r Router) {
+		r.Get("/users/:id", func() {}).Name("user")
+	})
+	u, err = secure.URLForParams("user", Params{"tenant": "acme", "id": "5"}, nil)
+	expect(t, err, nil)
+	expect(t, u, "https://acme.example.com/users/5")
+	expect(t, secure.URLFor("user", "acme", 5), "https://acme.example.com/users/5")
+
+	for _, tt := range []struct {
+		name   string
+		params Params
+		err    string
+	}{
+		{"nope", nil, `martini: route "nope" not found`},
+		{"user", Params{"id": "5"}, `martini: missing param "name" for the route "/users/:id<int>/:name"`},
+		{"user", Params{"id": "five", "name": "x"}, `martini: param "id" doesn't match "-?[0-9]+" for the route "/users/:id<int>/:name"`},
+		{"baz", Params{"name": "JOHN"}, `martini: param "name" doesn't match "[a-z]*" for the route "/baz/(?P<name>[a-z]*)\\.json"`},
+		{"color", nil, `martini: can't build a URL for the pattern "/colou?r"`},
+		{"home", nil, `martini: missing or invalid host param "tenant" for the host ":tenant.example.com"`},
+	} {
+		_, err := router.URLForParams(tt.name, tt.params, nil)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("expected error %q - got %v", tt.err, err)
+		}
+	}
+}
+
 func Test_AllRoutes(t *testing.T) {
 	router := NewRouter()
 
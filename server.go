@@ -0,0 +1,285 @@
+package martini
+
+import (
+	gocontext "context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/insionng/martini/inject"
+)
+
+// RunOptions is a struct for specifying configuration options for Martini.RunWithOptions.
+type RunOptions struct {
+	// Addr is the address to listen on, see Addrs. When no other listener is configured, it defaults to
+	// os.Getenv("HOST") and os.Getenv("PORT") or 9000.
+	Addr string
+	// Addrs are more addresses to listen on. Addresses starting with "unix:", such as "unix:/run/app.sock", are
+	// Unix domain sockets, the others are TCP addresses.
+	Addrs []string
+	// UnixSocketMode sets the permissions of the Unix domain sockets. Zero leaves them as the umask makes them.
+	UnixSocketMode os.FileMode
+	// Listener and Listeners are served as well.
+	Listener  net.Listener
+	Listeners []net.Listener
+	// SystemdListeners serves the sockets passed with the LISTEN_FDS socket activation protocol as well.
+	SystemdListeners bool
+	// TLS serves HTTPS when it is set.
+	TLS *TLSOptions
+	// ReadTimeout, ReadHeaderTimeout, WriteTimeout and IdleTimeout are passed on to the http.Server.
+	// Zero means no timeout.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout is how long in-flight requests get to finish after a shutdown signal. Defaults to 30 seconds.
+	ShutdownTimeout time.Duration
+	// Signals that trigger a graceful shutdown. Defaults to os.Interrupt and syscall.SIGTERM.
+	Signals []os.Signal
+	// DisableSignals stops RunWithOptions from handling shutdown signals, including the ones set in Signals.
+	// Use Shutdown to stop the server.
+	DisableSignals bool
+	// Upgrade turns on zero-downtime upgrades: on SIGHUP or SIGUSR2, or a call to Martini.Upgrade, the executable
+	// is started again and handed the listeners, and this process drains once the new one serves them.
+	// The new process has to run with Upgrade set as well. Upgrades aren't supported on Windows.
+	Upgrade bool
+	// UpgradeTimeout is how long a new process gets to start serving. Defaults to 30 seconds.
+	UpgradeTimeout time.Duration
+}
+
+func prepareRunOptions(options []RunOptions) RunOptions {
+	var opt RunOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	// Defaults
+	if opt.ShutdownTimeout == 0 {
+		opt.ShutdownTimeout = 30 * time.Second
+	}
+	if opt.UpgradeTimeout == 0 {
+		opt.UpgradeTimeout = 30 * time.Second
+	}
+	if opt.DisableSignals {
+		opt.Signals = nil
+	} else if len(opt.Signals) == 0 {
+		opt.Signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	return opt
+}
+
+// serverState is the state of a server started by RunWithOptions.
+type serverState struct {
+	server    *http.Server
+	listeners []net.Listener
+	opt       RunOptions
+	// cancel cancels the contexts of the requests.
+	cancel gocontext.CancelFunc
+	// done is closed when Shutdown has finished, err is what it returned.
+	done chan struct{}
+	err  error
+}
+
+// OnStart adds handlers that are invoked once the server started by RunWithOptions is listening. They can be
+// injected with the mapped services and the *http.Server. If a handler returns a non-nil error, the server is
+// stopped and RunWithOptions returns the error.
+func (m *Martini) OnStart(handlers ...Handler) {
+	for _, handler := range handlers {
+		validateHandler(handler)
+	}
+	m.onStart = append(m.onStart, handlers...)
+}
+
+// OnShutdown adds handlers that are invoked by Shutdown once the in-flight requests are done. They can be
+// injected with the mapped services, the *http.Server and the context.Context passed to Shutdown.
+func (m *Martini) OnShutdown(handlers ...Handler) {
+	for _, handler := range handlers {
+		validateHandler(handler)
+	}
+	m.onShutdown = append(m.onShutdown, handlers...)
+}
+
+// RunWithOptions runs the http server until it is shut down by one of the signals or a call to Shutdown.
+// In-flight requests are drained before it returns. It returns nil after a graceful shutdown.
+func (m *Martini) RunWithOptions(options ...RunOptions) error {
+	opt := prepareRunOptions(options)
+	logger := m.Injector.Get(reflect.TypeOf(m.logger)).Interface().(*log.Logger)
+
+	var tlsConfig *tls.Config
+	if opt.TLS != nil {
+		cfg, reloader, err := opt.TLS.tlsConfig()
+		if err != nil {
+			return err
+		}
+		tlsConfig = cfg
+		if opt.TLS.ReloadInterval > 0 {
+			stop := make(chan struct{})
+			defer close(stop)
+			go reloader.watch(opt.TLS.ReloadInterval, stop, logger)
+		}
+	}
+
+	var listeners []net.Listener
+	var ready *os.File
+	if opt.Upgrade {
+		// started by an upgrade, serve the listeners of the old process
+		var err error
+		if listeners, ready, err = upgradeListeners(); err != nil {
+			return err
+		}
+	}
+	if listeners == nil {
+		var err error
+		if listeners, err = opt.listeners(); err != nil {
+			return err
+		}
+	}
+
+	srv := &http.Server{
+		Handler:           m,
+		ReadTimeout:       opt.ReadTimeout,
+		ReadHeaderTimeout: opt.ReadHeaderTimeout,
+		WriteTimeout:      opt.WriteTimeout,
+		IdleTimeout:       opt.IdleTimeout,
+		TLSConfig:         tlsConfig,
+		ErrorLog:          logger,
+	}
+	baseCtx, cancel := gocontext.WithCancel(gocontext.Background())
+	defer cancel()
+	shutdown := make(chan struct{})
+	baseCtx = gocontext.WithValue(baseCtx, shutdownKey{}, (<-chan struct{})(shutdown))
+	srv.BaseContext = func(net.Listener) gocontext.Context {
+		return baseCtx
+	}
+	srv.RegisterOnShutdown(func() {
+		close(shutdown)
+	})
+	state := &serverState{server: srv, listeners: listeners, opt: opt, cancel: cancel, done: make(chan struct{})}
+	m.mu.Lock()
+	m.state = state
+	m.mu.Unlock()
+
+	var sigc, upgradec chan os.Signal
+	if len(opt.Signals) > 0 {
+		sigc = make(chan os.Signal, 1)
+		signal.Notify(sigc, opt.Signals...)
+		defer signal.Stop(sigc)
+	}
+	if opt.Upgrade && len(upgradeSignals) > 0 {
+		upgradec = make(chan os.Signal, 1)
+		signal.Notify(upgradec, upgradeSignals...)
+		defer signal.Stop(upgradec)
+	}
+
+	errc := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			if tlsConfig != nil {
+				// the certificate comes from the config's GetCertificate
+				errc <- srv.ServeTLS(ln, "", "")
+				return
+			}
+			errc <- srv.Serve(ln)
+		}(ln)
+		logger.Printf("listening on %s:%s (%s)\n", ln.Addr().Network(), ln.Addr(), Env)
+	}
+
+	if err := m.runHooks(m.onStart, srv, nil); err != nil {
+		m.Shutdown(gocontext.Background())
+		return err
+	}
+	if ready != nil {
+		// tell the old process it can drain
+		ready.Write([]byte{1})
+		ready.Close()
+	}
+
+	for {
+		select {
+		case err := <-errc:
+			if err != http.ErrServerClosed {
+				// stop the other listeners as well
+				m.Shutdown(gocontext.Background())
+				return err
+			}
+			// Shutdown was called
+			<-state.done
+			return state.err
+		case sig := <-upgradec:
+			logger.Printf("received %v, upgrading\n", sig)
+			if err := m.Upgrade(); err != nil {
+				logger.Printf("upgrade failed: %v\n", err)
+			}
+		case sig := <-sigc:
+			logger.Printf("received %v, shutting down\n", sig)
+			ctx, cancel := gocontext.WithTimeout(gocontext.Background(), opt.ShutdownTimeout)
+			defer cancel()
+			return m.Shutdown(ctx)
+		}
+	}
+}
+
+// Shutdown gracefully stops the server started by RunWithOptions. It stops listening, waits for in-flight
+// requests to finish until the context is done and then invokes the OnShutdown handlers. Streamed responses and
+// SSE streams end as soon as the shutdown begins. Requests that are still in flight when the context is done get
+// their contexts cancelled and their connections closed.
+func (m *Martini) Shutdown(ctx gocontext.Context) error {
+	m.mu.Lock()
+	state := m.state
+	m.state = nil
+	m.mu.Unlock()
+	if state == nil {
+		return nil
+	}
+
+	err := state.server.Shutdown(ctx)
+	if err != nil {
+		state.cancel()
+		state.server.Close()
+	}
+	if hookErr := m.runHooks(m.onShutdown, state.server, ctx); err == nil {
+		err = hookErr
+	}
+	state.err = err
+	close(state.done)
+	return err
+}
+
+type shutdownKey struct{}
+
+// shuttingDown returns a channel that is closed when the server that received the request with the context
+// begins to shut down, or nil if it wasn't started by RunWithOptions.
+func shuttingDown(ctx gocontext.Context) <-chan struct{} {
+	shutdown, _ := ctx.Value(shutdownKey{}).(<-chan struct{})
+	return shutdown
+}
+
+// runHooks invokes lifecycle handlers and returns the first error one of them returns.
+func (m *Martini) runHooks(handlers []Handler, srv *http.Server, ctx gocontext.Context) error {
+	inj := inject.New()
+	inj.SetParent(m)
+	inj.Map(srv)
+	if ctx != nil {
+		inj.MapTo(ctx, (*gocontext.Context)(nil))
+	}
+
+	var first error
+	for _, h := range handlers {
+		vals, err := inj.Invoke(h)
+		if err != nil {
+			panic(err)
+		}
+		if len(vals) > 0 {
+			if err, ok := vals[len(vals)-1].Interface().(error); ok && err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
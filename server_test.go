@@ -0,0 +1,180 @@
+package martini
+
+import (
+	gocontext "context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_Martini_Shutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	expect(t, err, nil)
+
+	m := New()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Map(&service{"db"})
+	started := make(chan struct{})
+	inFlight := make(chan struct{})
+	m.Action(func(res http.ResponseWriter) {
+		close(inFlight)
+		time.Sleep(50 * time.Millisecond)
+		res.Write([]byte("done"))
+	})
+
+	result := ""
+	m.OnStart(func(srv *http.Server, s *service) {
+		result += "start " + s.name
+		close(started)
+	})
+	m.OnShutdown(func(ctx gocontext.Context, s *service) error {
+		expect(t, ctx.Err(), nil)
+		result += " stop " + s.name
+		return nil
+	})
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- m.RunWithOptions(RunOptions{Listener: ln, DisableSignals: true})
+	}()
+	<-started
+
+	resc := make(chan *http.Response, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String())
+		expect(t, err, nil)
+		resc <- res
+	}()
+	<-inFlight
+
+	expect(t, m.Shutdown(gocontext.Background()), nil)
+	expect(t, <-errc, nil)
+
+	res := <-resc
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	expect(t, string(body), "done")
+	expect(t, result, "start db stop db")
+
+	// the listener is closed
+	_, err = http.Get("http://" + ln.Addr().String())
+	refute(t, err, nil)
+	expect(t, m.Shutdown(gocontext.Background()), nil)
+}
+
+func Test_Martini_ShutdownEndsStreams(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	expect(t, err, nil)
+
+	m := New()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	r := NewRouter()
+	m.Action(r.Handle)
+	inFlight := make(chan struct{}, 2)
+	r.Get("/events", SSE(), func(s *EventStream) {
+		inFlight <- struct{}{}
+		<-s.Done()
+	})
+	r.Get("/stream", func() <-chan string {
+		inFlight <- struct{}{}
+		return make(chan string)
+	})
+	started := make(chan struct{})
+	m.OnStart(func() {
+		close(started)
+	})
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- m.RunWithOptions(RunOptions{Listener: ln, DisableSignals: true})
+	}()
+	<-started
+
+	for _, path := range []string{"/events", "/stream"} {
+		go func(path string) {
+			res, err := http.Get("http://" + ln.Addr().String() + path)
+			if err == nil {
+				ioutil.ReadAll(res.Body)
+				res.Body.Close()
+			}
+		}(path)
+	}
+	<-inFlight
+	<-inFlight
+
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 5*time.Second)
+	defer cancel()
+	expect(t, m.Shutdown(ctx), nil)
+	expect(t, <-errc, nil)
+}
+
+func Test_Martini_ShutdownDeadline(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	expect(t, err, nil)
+
+	m := New()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	inFlight := make(chan struct{})
+	cancelled := make(chan struct{})
+	m.Action(func(req *http.Request) {
+		close(inFlight)
+		<-req.Context().Done()
+		close(cancelled)
+	})
+	started := make(chan struct{})
+	m.OnStart(func() {
+		close(started)
+	})
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- m.RunWithOptions(RunOptions{Listener: ln, DisableSignals: true})
+	}()
+	<-started
+
+	go http.Get("http://" + ln.Addr().String())
+	<-inFlight
+
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 50*time.Millisecond)
+	defer cancel()
+	expect(t, m.Shutdown(ctx), gocontext.DeadlineExceeded)
+	expect(t, <-errc, gocontext.DeadlineExceeded)
+	<-cancelled
+}
+
+func Test_Martini_OnStartError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	expect(t, err, nil)
+
+	m := New()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	stopped := false
+	m.OnStart(func() error {
+		return errors.New("no database")
+	})
+	m.OnShutdown(func() {
+		stopped = true
+	})
+
+	err = m.RunWithOptions(RunOptions{Listener: ln, DisableSignals: true})
+	expect(t, err.Error(), "no database")
+	expect(t, stopped, true)
+}
+
+func Test_PrepareRunOptions(t *testing.T) {
+	opt := prepareRunOptions([]RunOptions{{Addr: ":8080"}})
+	expect(t, opt.Addr, ":8080")
+	expect(t, opt.ShutdownTimeout, 30*time.Second)
+	expect(t, len(opt.Signals), 2)
+
+	opt = prepareRunOptions([]RunOptions{{DisableSignals: true}})
+	expect(t, len(opt.Signals), 0)
+
+	opt = prepareRunOptions([]RunOptions{{Signals: []os.Signal{os.Interrupt}, DisableSignals: true}})
+	expect(t, len(opt.Signals), 0)
+}
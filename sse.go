@@ -0,0 +1,330 @@
+package martini
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentEventStream is the media type of Server-Sent Events.
+const ContentEventStream = "text/event-stream"
+
+// ErrSlowSubscriber is returned by EventHub.Serve when the stream didn't keep up with the published events.
+// The client reconnects on its own and gets the events it missed from the hub's history.
+var ErrSlowSubscriber = errors.New("martini: the event stream fell behind and was dropped")
+
+// Event is a Server-Sent Event. Data that isn't a string or a byte slice is sent as JSON.
+type Event struct {
+	// ID lets the client resume after it, it sends the ID of the last event it got when it reconnects.
+	ID string
+	// Event is the type of the event, clients receive events without one as "message".
+	Event string
+	// Retry tells the client how long to wait before it reconnects.
+	Retry time.Duration
+	Data  interface{}
+}
+
+// SSEOptions is a struct for specifying configuration options for the martini.SSE middleware.
+type SSEOptions struct {
+	// Heartbeat is how often a comment is sent to keep idle connections open. Defaults to 15 seconds.
+	Heartbeat time.Duration
+	// Retry is sent to the client when the stream starts, if set.
+	Retry time.Duration
+}
+
+func prepareSSEOptions(options []SSEOptions) SSEOptions {
+	var opt SSEOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	// Defaults
+	if opt.Heartbeat == 0 {
+		opt.Heartbeat = 15 * time.Second
+	}
+	return opt
+}
+
+// SSE returns a middleware handler that starts a Server-Sent Events response and maps an *EventStream to send
+// the events with. The stream ends when the handlers after SSE return, when the client goes away, or when the
+// server shuts down.
+//
+//	m.Get("/events", martini.SSE(), func(s *martini.EventStream, hub *martini.EventHub) {
+//		hub.Serve(s)
+//	})
+func SSE(options ...SSEOptions) Handler {
+	opt := prepareSSEOptions(options)
+	return func(c Context, res http.ResponseWriter, req *http.Request) {
+		ctx, cancel := gocontext.WithCancel(req.Context())
+		defer cancel()
+		s := &EventStream{w: res, ctx: ctx, lastEventID: req.Header.Get("Last-Event-ID")}
+
+		h := res.Header()
+		h.Set(ContentType, ContentEventStream)
+		h.Set("Cache-Control", "no-cache")
+		h.Set("Connection", "keep-alive")
+		// keep proxies like nginx from buffering the events
+		h.Set("X-Accel-Buffering", "no")
+		res.WriteHeader(http.StatusOK)
+		if opt.Retry > 0 {
+			s.write(fmt.Sprintf("retry: %d\n\n", opt.Retry/time.Millisecond))
+		} else {
+			s.flush()
+		}
+		c.Map(s)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			ticker := time.NewTicker(opt.Heartbeat)
+			defer ticker.Stop()
+			closed := closeNotify(res)
+			shutdown := shuttingDown(ctx)
+			for {
+				select {
+				case <-ticker.C:
+					s.write(": heartbeat\n\n")
+				case <-closed:
+					cancel()
+				case <-shutdown:
+					cancel()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		c.Next()
+		s.close()
+		cancel()
+		<-done
+	}
+}
+
+// closeNotify returns the CloseNotify channel of the response, or nil if it doesn't have one.
+func closeNotify(res http.ResponseWriter) <-chan bool {
+	if rw, ok := res.(*responseWriter); ok {
+		res = rw.ResponseWriter
+	}
+	if cn, ok := res.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
+
+// EventStream sends Server-Sent Events to a client. It is mapped by the SSE middleware and safe to use from
+// several goroutines.
+type EventStream struct {
+	mu          sync.Mutex
+	w           http.ResponseWriter
+	ctx         gocontext.Context
+	lastEventID string
+	closed      bool
+}
+
+// Send writes the event to the client and flushes it. It fails once the stream has ended.
+func (s *EventStream) Send(e Event) error {
+	var b strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", oneLine(e.ID))
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", oneLine(e.Event))
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry/time.Millisecond)
+	}
+	var data string
+	switch v := e.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		j, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data = string(j)
+	}
+	// \r\n, \n and a lone \r all end lines of the stream
+	data = strings.Replace(strings.Replace(data, "\r\n", "\n", -1), "\r", "\n", -1)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// LastEventID returns the ID of the last event the client got before it reconnected, or "".
+func (s *EventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done returns a channel that is closed when the stream ends.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+func (s *EventStream) write(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("martini: the event stream has ended")
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := s.w.Write([]byte(text)); err != nil {
+		return err
+	}
+	s.flushLocked()
+	return nil
+}
+
+func (s *EventStream) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked()
+}
+
+func (s *EventStream) flushLocked() {
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *EventStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+}
+
+// oneLine keeps a field from breaking the event apart.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// EventHubOptions is a struct for specifying configuration options for an EventHub.
+type EventHubOptions struct {
+	// History is how many of the last events are kept for clients that reconnect. Defaults to 100.
+	History int
+	// Buffer is how many events a stream can fall behind before it is dropped. Defaults to 16.
+	Buffer int
+}
+
+func prepareEventHubOptions(options []EventHubOptions) EventHubOptions {
+	var opt EventHubOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	// Defaults
+	if opt.History == 0 {
+		opt.History = 100
+	}
+	if opt.Buffer == 0 {
+		opt.Buffer = 16
+	}
+	return opt
+}
+
+// EventHub fans published events out to the event streams it serves. Map one to share it between handlers.
+type EventHub struct {
+	mu          sync.Mutex
+	opt         EventHubOptions
+	subscribers map[chan Event]struct{}
+	history     []Event
+	lastID      uint64
+}
+
+// NewEventHub returns an EventHub without subscribers.
+func NewEventHub(options ...EventHubOptions) *EventHub {
+	return &EventHub{opt: prepareEventHubOptions(options), subscribers: make(map[chan Event]struct{})}
+}
+
+// Publish sends the event to every stream the hub serves and keeps it for clients that reconnect. Events
+// without an ID get the next number. Publish doesn't wait for slow streams, they are dropped instead.
+func (h *EventHub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e.ID == "" {
+		h.lastID++
+		e.ID = strconv.FormatUint(h.lastID, 10)
+	}
+	h.history = append(h.history, e)
+	if len(h.history) > h.opt.History {
+		h.history = h.history[len(h.history)-h.opt.History:]
+	}
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Serve sends the published events to the stream until the stream ends, starting with the events the client
+// missed since its Last-Event-ID. It returns nil once the stream ends.
+func (h *EventHub) Serve(s *EventStream) error {
+	ch := make(chan Event, h.opt.Buffer)
+	h.mu.Lock()
+	missed := h.since(s.LastEventID())
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	defer h.unsubscribe(ch)
+
+	for _, e := range missed {
+		if err := s.Send(e); err != nil {
+			return nil
+		}
+	}
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return ErrSlowSubscriber
+			}
+			if err := s.Send(e); err != nil {
+				return nil
+			}
+		case <-s.Done():
+			return nil
+		}
+	}
+}
+
+// Subscribers returns how many streams the hub serves.
+func (h *EventHub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// since returns the events after the one with the ID. All of the history is returned if the ID is too old.
+func (h *EventHub) since(id string) []Event {
+	if id == "" {
+		return nil
+	}
+	for i := len(h.history) - 1; i >= 0; i-- {
+		if h.history[i].ID == id {
+			return append([]Event(nil), h.history[i+1:]...)
+		}
+	}
+	return append([]Event(nil), h.history...)
+}
+
+func (h *EventHub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, ch)
+}
@@ -0,0 +1,126 @@
+package martini
+
+import (
+	"bufio"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_SSESend(t *testing.T) {
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Get("/events", SSE(SSEOptions{Retry: 3 * time.Second}), func(s *EventStream) {
+		s.Send(Event{ID: "1", Event: "greeting", Data: "hello\nworld"})
+		s.Send(Event{Data: map[string]int{"users": 2}})
+		s.Send(Event{Data: "x\rid: 99\r\ny"})
+	})
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/events", nil)
+	m.ServeHTTP(res, req)
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Header().Get(ContentType), ContentEventStream)
+	expect(t, res.Header().Get("Cache-Control"), "no-cache")
+	expect(t, res.Body.String(), "retry: 3000\n\n"+
+		"id: 1\nevent: greeting\ndata: hello\ndata: world\n\n"+
+		"data: {\"users\":2}\n\n"+
+		"data: x\ndata: id: 99\ndata: y\n\n")
+}
+
+func Test_SSEHeartbeat(t *testing.T) {
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Get("/events", SSE(SSEOptions{Heartbeat: 10 * time.Millisecond}), func(s *EventStream) {
+		<-s.Done()
+	})
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/events")
+	expect(t, err, nil)
+	defer res.Body.Close()
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	expect(t, err, nil)
+	expect(t, line, ": heartbeat\n")
+}
+
+// readEvents reads the data of n events from the stream.
+func readEvents(t *testing.T, r *bufio.Reader, n int) []string {
+	var data []string
+	for len(data) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(line, "data: ") {
+			data = append(data, strings.TrimSpace(line[len("data: "):]))
+		}
+	}
+	return data
+}
+
+func Test_EventHub(t *testing.T) {
+	hub := NewEventHub()
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Map(hub)
+	m.Get("/events", SSE(), func(s *EventStream, hub *EventHub) {
+		hub.Serve(s)
+	})
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	subscribe := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest("GET", server.URL+"/events", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		expect(t, err, nil)
+		return res, bufio.NewReader(res.Body)
+	}
+	waitFor := func(n int) {
+		for deadline := time.Now().Add(5 * time.Second); hub.Subscribers() != n; {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d subscribers, got %d", n, hub.Subscribers())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	res1, r1 := subscribe("")
+	res2, r2 := subscribe("")
+	waitFor(2)
+	hub.Publish(Event{Data: "a"})
+	hub.Publish(Event{Data: "b"})
+	expectDeep(t, readEvents(t, r1, 2), []string{"a", "b"})
+	expectDeep(t, readEvents(t, r2, 2), []string{"a", "b"})
+
+	// the first client reconnects and gets what it missed
+	res1.Body.Close()
+	waitFor(1)
+	hub.Publish(Event{Data: "c"})
+	res1, r1 = subscribe("1")
+	defer res1.Body.Close()
+	expectDeep(t, readEvents(t, r1, 2), []string{"b", "c"})
+	expectDeep(t, readEvents(t, r2, 1), []string{"c"})
+	res2.Body.Close()
+	waitFor(1)
+}
+
+func Test_EventHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewEventHub(EventHubOptions{Buffer: 1})
+	ch := make(chan Event, 1)
+	hub.subscribers[ch] = struct{}{}
+	hub.Publish(Event{Data: "a"})
+	hub.Publish(Event{Data: "b"})
+	expect(t, hub.Subscribers(), 0)
+	expect(t, (<-ch).ID, "1")
+	_, ok := <-ch
+	expect(t, ok, false)
+}
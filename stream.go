@@ -0,0 +1,113 @@
+package martini
+
+import (
+	gocontext "context"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+)
+
+var (
+	readerType     = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	writerFuncType = reflect.TypeOf((func(io.Writer) error)(nil))
+)
+
+// isStream reports whether the ReturnHandler streams the value instead of writing it at once: an io.Reader,
+// a channel of strings or byte slices, or a func(io.Writer) error.
+func isStream(val reflect.Value) bool {
+	t := val.Type()
+	switch {
+	case t.Implements(readerType), t == writerFuncType:
+		return true
+	case t.Kind() == reflect.Chan && t.ChanDir()&reflect.RecvDir != 0:
+		elem := t.Elem()
+		return elem.Kind() == reflect.String || elem.Kind() == reflect.Slice && elem.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+// stream writes the value piece by piece, flushing each one to the client. It stops once the request's
+// context is done, which happens when the client goes away, or when the server shuts down.
+func stream(c Context, res http.ResponseWriter, status int, val reflect.Value) {
+	req := c.Get(requestType).Interface().(*http.Request)
+	ctx, cancel := gocontext.WithCancel(req.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-shuttingDown(ctx):
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	w := &flushWriter{w: res, ctx: ctx}
+	if status != 0 {
+		res.WriteHeader(status)
+	}
+
+	var err error
+	switch v := val.Interface().(type) {
+	case func(io.Writer) error:
+		err = v(w)
+	case io.Reader:
+		if closer, ok := v.(io.Closer); ok {
+			defer closer.Close()
+		}
+		_, err = io.Copy(w, v)
+	default:
+		err = streamChan(ctx, w, val)
+	}
+
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+	if rw, ok := res.(ResponseWriter); !ok || !rw.Written() {
+		handleError(c, err)
+	} else if v := c.Get(reflect.TypeOf((*log.Logger)(nil))); v.IsValid() {
+		// too late to tell the client
+		v.Interface().(*log.Logger).Printf("ERROR: %s %s: streaming the response: %v\n", req.Method, req.URL.Path, err)
+	}
+}
+
+// streamChan writes what is received from the channel until it is closed or the context is done.
+func streamChan(ctx gocontext.Context, w io.Writer, ch reflect.Value) error {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+	for {
+		chosen, v, ok := reflect.Select(cases)
+		if chosen == 1 {
+			return ctx.Err()
+		}
+		if !ok {
+			return nil
+		}
+		var err error
+		if v.Kind() == reflect.String {
+			_, err = io.WriteString(w, v.String())
+		} else {
+			_, err = w.Write(v.Bytes())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// flushWriter flushes every write to the client, and fails once the context is done.
+type flushWriter struct {
+	w   http.ResponseWriter
+	ctx gocontext.Context
+}
+
+func (fw *flushWriter) Write(b []byte) (int, error) {
+	if err := fw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := fw.w.Write(b)
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,126 @@
+package martini
+
+import (
+	"bufio"
+	gocontext "context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type closeReader struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func Test_ReturnHandlerStreams(t *testing.T) {
+	defer setENV(Env)
+	setENV(Dev)
+
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	reader := &closeReader{Reader: strings.NewReader("from a reader")}
+	m.Get("/reader", func() io.Reader {
+		return reader
+	})
+	m.Get("/strings", func() (int, <-chan string) {
+		ch := make(chan string)
+		go func() {
+			defer close(ch)
+			for i := 0; i < 3; i++ {
+				ch <- fmt.Sprint(i)
+			}
+		}()
+		return http.StatusAccepted, ch
+	})
+	m.Get("/bytes", func() chan []byte {
+		ch := make(chan []byte, 2)
+		ch <- []byte("a")
+		ch <- []byte("b")
+		close(ch)
+		return ch
+	})
+	m.Get("/writer", func() func(io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, "from a writer")
+			return err
+		}
+	})
+	m.Get("/failing", func() func(io.Writer) error {
+		return func(w io.Writer) error {
+			return NewHTTPError(http.StatusConflict, "export is running")
+		}
+	})
+
+	for _, tt := range []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/reader", http.StatusOK, "from a reader"},
+		{"/strings", http.StatusAccepted, "012"},
+		{"/bytes", http.StatusOK, "ab"},
+		{"/writer", http.StatusOK, "from a writer"},
+		{"/failing", http.StatusConflict, "export is running"},
+	} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		m.ServeHTTP(res, req)
+		expect(t, res.Code, tt.code)
+		if !strings.Contains(res.Body.String(), tt.body) {
+			t.Errorf("%s: expected %q in %q", tt.path, tt.body, res.Body.String())
+		}
+	}
+	expect(t, reader.closed, true)
+}
+
+func Test_ReturnHandlerStreamFlushesAndStops(t *testing.T) {
+	stopped := make(chan error, 1)
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Get("/", func(ctx gocontext.Context) <-chan string {
+		ch := make(chan string)
+		go func() {
+			defer close(ch)
+			for i := 0; ; i++ {
+				select {
+				case ch <- fmt.Sprintf("line %d\n", i):
+				case <-ctx.Done():
+					stopped <- ctx.Err()
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+		return ch
+	})
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	expect(t, err, nil)
+	// the first line arrives while the handler is still streaming
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	expect(t, err, nil)
+	expect(t, line, "line 0\n")
+	res.Body.Close()
+
+	select {
+	case err := <-stopped:
+		expect(t, errors.Is(err, gocontext.Canceled), true)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream didn't stop after the client went away")
+	}
+}
@@ -0,0 +1,262 @@
+package martini
+
+import (
+	"bufio"
+	gocontext "context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TimeoutOptions is a struct for specifying configuration options for the martini.Timeout middleware.
+type TimeoutOptions struct {
+	// Status is the status code of the response written when the deadline passes. Defaults to 503.
+	Status int
+	// Body of the response written when the deadline passes. Defaults to the text of the status.
+	Body string
+	// ContentType of the response written when the deadline passes. Defaults to "text/plain; charset=utf-8".
+	ContentType string
+}
+
+func prepareTimeoutOptions(options []TimeoutOptions) TimeoutOptions {
+	var opt TimeoutOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	// Defaults
+	if opt.Status == 0 {
+		opt.Status = http.StatusServiceUnavailable
+	}
+	if len(opt.Body) == 0 {
+		opt.Body = http.StatusText(opt.Status)
+	}
+	if len(opt.ContentType) == 0 {
+		opt.ContentType = ContentText + "; charset=utf-8"
+	}
+	return opt
+}
+
+// Timeout returns a middleware handler that gives the handlers after it d to respond. The request's
+// context.Context is cancelled when the deadline passes, and a 503 is written if nothing was written yet.
+// The handler chain stops after the handler that is running, and anything it writes late is discarded.
+// Timeout waits for that handler to return, so handlers should give up once the context is done.
+// Connections that are hijacked, like WebSockets, get no timeout response, but their context is cancelled too.
+//
+// Add it to a Martini with Use to limit every request, or to a route or group to limit only those.
+func Timeout(d time.Duration, options ...TimeoutOptions) Handler {
+	opt := prepareTimeoutOptions(options)
+	return func(c Context, ctx gocontext.Context, res http.ResponseWriter) {
+		tc := newTimeoutContext(ctx, time.Now().Add(d))
+		defer tc.cancel()
+		SetRequestContext(c, tc)
+
+		tw := &timeoutWriter{w: res.(ResponseWriter), header: make(http.Header)}
+		c.MapTo(tw, (*http.ResponseWriter)(nil))
+		if setter, ok := c.(responseWriterSetter); ok {
+			// make the handler chain stop once the deadline passes
+			prev := setter.setResponseWriter(tw)
+			defer setter.setResponseWriter(prev)
+		}
+
+		done := make(chan struct{})
+		var p interface{}
+		go func() {
+			defer close(done)
+			defer func() {
+				p = recover()
+			}()
+			c.Next()
+		}()
+
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			// respond before the handlers learn about the deadline, so they can't write first
+			tw.timeout(opt)
+			tc.expire()
+			<-done
+		}
+		if p != nil {
+			// let Recovery handle it
+			panic(p)
+		}
+	}
+}
+
+// timeoutContext is the context.Context of the handlers after Timeout. Timeout cancels it itself once the
+// timeout response is written, instead of letting the deadline cancel it.
+type timeoutContext struct {
+	gocontext.Context
+	cancel   gocontext.CancelFunc
+	deadline time.Time
+	expired  int32
+}
+
+func newTimeoutContext(parent gocontext.Context, deadline time.Time) *timeoutContext {
+	ctx, cancel := gocontext.WithCancel(parent)
+	if d, ok := parent.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return &timeoutContext{Context: ctx, cancel: cancel, deadline: deadline}
+}
+
+func (c *timeoutContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *timeoutContext) Err() error {
+	err := c.Context.Err()
+	if err != nil && atomic.LoadInt32(&c.expired) == 1 {
+		return gocontext.DeadlineExceeded
+	}
+	return err
+}
+
+func (c *timeoutContext) expire() {
+	atomic.StoreInt32(&c.expired, 1)
+	c.cancel()
+}
+
+// responseWriterSetter is implemented by the request contexts whose Written method Timeout has to take over.
+type responseWriterSetter interface {
+	// setResponseWriter sets the ResponseWriter of the context and returns the previous one.
+	setResponseWriter(ResponseWriter) ResponseWriter
+}
+
+func (c *context) setResponseWriter(rw ResponseWriter) ResponseWriter {
+	prev := c.rw
+	c.rw = rw
+	return prev
+}
+
+func (r *routeContext) setResponseWriter(rw ResponseWriter) ResponseWriter {
+	if setter, ok := r.Context.(responseWriterSetter); ok {
+		return setter.setResponseWriter(rw)
+	}
+	return nil
+}
+
+// timeoutWriter guards a ResponseWriter against the handlers that are still running after the deadline.
+// The handlers get their own header map, which is copied when they write the header.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	w        ResponseWriter
+	header   http.Header
+	timedOut bool
+	hijacked bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.w.Written() {
+		return
+	}
+	tw.writeHeader(status)
+}
+
+func (tw *timeoutWriter) writeHeader(status int) {
+	h := tw.w.Header()
+	for k, v := range tw.header {
+		h[k] = v
+	}
+	tw.w.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.w.Written() {
+		tw.writeHeader(http.StatusOK)
+	}
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.timedOut {
+		tw.w.Flush()
+	}
+}
+
+func (tw *timeoutWriter) Status() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.w.Status()
+}
+
+func (tw *timeoutWriter) Written() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.timedOut || tw.hijacked || tw.w.Written()
+}
+
+func (tw *timeoutWriter) Size() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.w.Size()
+}
+
+func (tw *timeoutWriter) Before(before BeforeFunc) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.w.Before(before)
+}
+
+// Hijack takes over the connection, the deadline doesn't apply to it anymore.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	hijacker, ok := tw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+	return conn, brw, err
+}
+
+func (tw *timeoutWriter) CloseNotify() <-chan bool {
+	return closeNotify(tw.w)
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// timeout writes the timeout response unless the handlers wrote one already, and discards later writes.
+func (tw *timeoutWriter) timeout(opt TimeoutOptions) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.timedOut = true
+	if tw.hijacked || tw.w.Written() {
+		return
+	}
+	h := tw.w.Header()
+	h.Set(ContentType, opt.ContentType)
+	// the body may be compressed, as by Gzip, so its length isn't known here
+	h.Del(ContentLength)
+	tw.w.WriteHeader(opt.Status)
+	tw.w.Write([]byte(opt.Body))
+	tw.w.Flush()
+}
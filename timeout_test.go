@@ -0,0 +1,143 @@
+package martini
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Timeout(t *testing.T) {
+	m := New()
+	m.Use(Timeout(20 * time.Millisecond))
+	result := ""
+	m.Use(func(ctx gocontext.Context, res http.ResponseWriter) {
+		<-ctx.Done()
+		result += "slow"
+		res.Header().Set("X-Late", "true")
+		_, err := res.Write([]byte("late"))
+		expect(t, err, http.ErrHandlerTimeout)
+	})
+	m.Action(func() {
+		result += "action"
+	})
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	m.ServeHTTP(res, req)
+
+	expect(t, res.Code, http.StatusServiceUnavailable)
+	expect(t, res.Body.String(), "Service Unavailable")
+	expect(t, res.Header().Get("X-Late"), "")
+	expect(t, result, "slow")
+}
+
+func Test_Timeout_Gzip(t *testing.T) {
+	m := New()
+	m.Use(Gzip())
+	m.Use(Timeout(20 * time.Millisecond))
+	m.Action(func(ctx gocontext.Context) {
+		<-ctx.Done()
+	})
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	// the transport asks for gzip and decompresses the body
+	res, err := http.Get(server.URL)
+	expect(t, err, nil)
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	expect(t, err, nil)
+	expect(t, res.StatusCode, http.StatusServiceUnavailable)
+	expect(t, res.Uncompressed, true)
+	expect(t, string(body), "Service Unavailable")
+}
+
+func Test_Timeout_Route(t *testing.T) {
+	router := NewRouter()
+	router.Get("/slow", func(ctx gocontext.Context) string {
+		<-ctx.Done()
+		return "late"
+	}).Use(Timeout(10*time.Millisecond, TimeoutOptions{Status: http.StatusGatewayTimeout, Body: "too slow"}))
+	router.Get("/fast", func(res http.ResponseWriter) string {
+		res.Header().Set("X-Fast", "true")
+		return "fast"
+	}).Use(Timeout(time.Second))
+
+	for path, expected := range map[string]struct {
+		code int
+		body string
+	}{
+		"/slow": {http.StatusGatewayTimeout, "too slow"},
+		"/fast": {http.StatusOK, "fast"},
+	} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.Handle(res, req, New().createContext(res, req))
+		expect(t, res.Code, expected.code)
+		expect(t, res.Body.String(), expected.body)
+	}
+}
+
+func Test_Timeout_Panic(t *testing.T) {
+	m := New()
+	m.Use(Recovery())
+	m.Use(Timeout(time.Second))
+	m.Action(func() {
+		panic("here")
+	})
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	m.ServeHTTP(res, req)
+	expect(t, res.Code, http.StatusInternalServerError)
+}
+
+func Test_TimeoutContext(t *testing.T) {
+	parent, cancel := gocontext.WithTimeout(gocontext.Background(), time.Minute)
+	defer cancel()
+	deadline, _ := parent.Deadline()
+
+	tc := newTimeoutContext(parent, time.Now().Add(time.Hour))
+	d, ok := tc.Deadline()
+	expect(t, ok, true)
+	expect(t, d, deadline)
+
+	expect(t, tc.Err(), nil)
+	tc.expire()
+	<-tc.Done()
+	expect(t, tc.Err(), gocontext.DeadlineExceeded)
+}
+
+func Test_Timeout_Hijack(t *testing.T) {
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Use(Timeout(20 * time.Millisecond))
+	m.Get("/ws", WebSocket(), func(ws *WebSocketConn) {
+		// the connection outlives the deadline
+		time.Sleep(100 * time.Millisecond)
+		ws.WriteMessage(TextMessage, []byte("hello"))
+	})
+	m.Get("/deadline", func(res http.ResponseWriter) string {
+		if err := http.NewResponseController(res).SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			return err.Error()
+		}
+		return "ok"
+	})
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	ws, _ := dialWebSocket(t, server.URL+"/ws", nil, WebSocketOptions{})
+	_, msg, err := ws.ReadMessage()
+	expect(t, err, nil)
+	expect(t, string(msg), "hello")
+
+	res, err := http.Get(server.URL + "/deadline")
+	expect(t, err, nil)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	expect(t, string(body), "ok")
+}
@@ -0,0 +1,141 @@
+package martini
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSOptions is a struct for specifying the TLS configuration of Martini.RunWithOptions.
+type TLSOptions struct {
+	// CertFile and KeyFile are the PEM encoded certificate (chain) and private key of the server.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM file with the CAs client certificates are verified against. Setting it turns on
+	// mutual TLS. The leaf of a verified client certificate can be injected into handlers as a *x509.Certificate,
+	// which is nil if the client sent none.
+	ClientCAFile string
+	// ClientAuth is the policy for client certificates. Defaults to tls.RequireAndVerifyClientCert if
+	// ClientCAFile is set.
+	ClientAuth tls.ClientAuthType
+	// ReloadInterval is how often the certificate and key files are checked for changes. When they change, new
+	// connections use the new certificate. Zero turns reloading off.
+	ReloadInterval time.Duration
+	// Config is used as the base of the TLS configuration when it is set.
+	Config *tls.Config
+}
+
+// tlsConfig returns the TLS configuration for the options along with the certificate reloader it uses.
+func (opt *TLSOptions) tlsConfig() (*tls.Config, *certReloader, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opt.Config != nil {
+		cfg = opt.Config.Clone()
+	}
+
+	reloader, err := newCertReloader(opt.CertFile, opt.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.GetCertificate = reloader.GetCertificate
+
+	if opt.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(opt.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, errors.New("martini: no certificates found in " + opt.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if opt.ClientAuth != tls.NoClientCert {
+		cfg.ClientAuth = opt.ClientAuth
+	}
+	return cfg, reloader, nil
+}
+
+// certReloader serves a certificate and key pair and reloads them when their files change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// reload loads the certificate and key again if one of their files changed since the last load.
+func (r *certReloader) reload() (bool, error) {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	r.cert, r.modTime = &cert, modTime
+	r.mu.Unlock()
+	return true, nil
+}
+
+// watch reloads the certificate every interval until stop is closed. Failed reloads keep the old certificate.
+func (r *certReloader) watch(interval time.Duration, stop <-chan struct{}, logger *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if ok, err := r.reload(); err != nil {
+				logger.Printf("reloading the certificate failed: %v\n", err)
+			} else if ok {
+				logger.Printf("reloaded the certificate from %s\n", r.certFile)
+			}
+		}
+	}
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
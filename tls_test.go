@@ -0,0 +1,216 @@
+package martini
+
+import (
+	gocontext "context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert creates a certificate for the common name, signed by the parent or self-signed if it is nil.
+func testCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	expect(t, err, nil)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	expect(t, err, nil)
+	cert, err := x509.ParseCertificate(der)
+	expect(t, err, nil)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	expect(t, err, nil)
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func Test_RunWithOptions_MutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "martini-tls")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	ca, caKey, caPEM, _ := testCert(t, "ca", nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCert(t, "server", ca, caKey)
+	_, _, clientPEM, clientKeyPEM := testCert(t, "client", ca, caKey)
+	for name, data := range map[string][]byte{"ca.pem": caPEM, "cert.pem": serverPEM, "key.pem": serverKeyPEM} {
+		expect(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0600), nil)
+	}
+
+	m := New()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Action(func(res http.ResponseWriter, peer *x509.Certificate) {
+		res.Write([]byte(peer.Subject.CommonName))
+	})
+	started := make(chan struct{})
+	m.OnStart(func() {
+		close(started)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	expect(t, err, nil)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- m.RunWithOptions(RunOptions{Listener: ln, DisableSignals: true, TLS: &TLSOptions{
+			CertFile:     filepath.Join(dir, "cert.pem"),
+			KeyFile:      filepath.Join(dir, "key.pem"),
+			ClientCAFile: filepath.Join(dir, "ca.pem"),
+		}})
+	}()
+	<-started
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	expect(t, err, nil)
+	url := "https://" + ln.Addr().String()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+	}}}
+	res, err := client.Get(url)
+	expect(t, err, nil)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	expect(t, string(body), "client")
+
+	// no client certificate
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	_, err = client.Get(url)
+	refute(t, err, nil)
+
+	expect(t, m.Shutdown(gocontext.Background()), nil)
+	expect(t, <-errc, nil)
+}
+
+func Test_RunWithOptions_OptionalClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "martini-tls")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	ca, caKey, caPEM, _ := testCert(t, "ca", nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCert(t, "server", ca, caKey)
+	_, _, clientPEM, clientKeyPEM := testCert(t, "client", ca, caKey)
+	for name, data := range map[string][]byte{"ca.pem": caPEM, "cert.pem": serverPEM, "key.pem": serverKeyPEM} {
+		expect(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0600), nil)
+	}
+
+	m := New()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Action(func(res http.ResponseWriter, peer *x509.Certificate) {
+		if peer == nil {
+			res.Write([]byte("anonymous"))
+			return
+		}
+		res.Write([]byte(peer.Subject.CommonName))
+	})
+	started := make(chan struct{})
+	m.OnStart(func() {
+		close(started)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	expect(t, err, nil)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- m.RunWithOptions(RunOptions{Listener: ln, DisableSignals: true, TLS: &TLSOptions{
+			CertFile:     filepath.Join(dir, "cert.pem"),
+			KeyFile:      filepath.Join(dir, "key.pem"),
+			ClientCAFile: filepath.Join(dir, "ca.pem"),
+			ClientAuth:   tls.VerifyClientCertIfGiven,
+		}})
+	}()
+	<-started
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	expect(t, err, nil)
+	url := "https://" + ln.Addr().String()
+
+	for _, tt := range []struct {
+		certs []tls.Certificate
+		body  string
+	}{
+		{[]tls.Certificate{clientCert}, "client"},
+		{nil, "anonymous"},
+	} {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: tt.certs,
+		}}}
+		res, err := client.Get(url)
+		expect(t, err, nil)
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		expect(t, res.StatusCode, http.StatusOK)
+		expect(t, string(body), tt.body)
+	}
+
+	expect(t, m.Shutdown(gocontext.Background()), nil)
+	expect(t, <-errc, nil)
+}
+
+func Test_CertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "martini-tls")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	_, _, certPEM, keyPEM := testCert(t, "old", nil, nil)
+	expect(t, ioutil.WriteFile(certFile, certPEM, 0600), nil)
+	expect(t, ioutil.WriteFile(keyFile, keyPEM, 0600), nil)
+
+	r, err := newCertReloader(certFile, keyFile)
+	expect(t, err, nil)
+	old, _ := r.GetCertificate(nil)
+
+	reloaded, err := r.reload()
+	expect(t, err, nil)
+	expect(t, reloaded, false)
+
+	_, _, certPEM, keyPEM = testCert(t, "new", nil, nil)
+	expect(t, ioutil.WriteFile(certFile, certPEM, 0600), nil)
+	expect(t, ioutil.WriteFile(keyFile, keyPEM, 0600), nil)
+	later := time.Now().Add(time.Minute)
+	expect(t, os.Chtimes(certFile, later, later), nil)
+
+	reloaded, err = r.reload()
+	expect(t, err, nil)
+	expect(t, reloaded, true)
+	cert, _ := r.GetCertificate(nil)
+	refute(t, cert, old)
+
+	// a broken pair keeps the current certificate
+	expect(t, ioutil.WriteFile(keyFile, []byte("broken"), 0600), nil)
+	expect(t, os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute)), nil)
+	_, err = r.reload()
+	refute(t, err, nil)
+	current, _ := r.GetCertificate(nil)
+	expect(t, current, cert)
+}
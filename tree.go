@@ -0,0 +1,427 @@
+package martini
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// regexpMeta holds the characters that give a route pattern regular expression semantics.
+const regexpMeta = `\.+*?()|[]{}^$`
+
+type tokenKind uint8
+
+const (
+	literalToken tokenKind = iota
+	paramToken
+	catchAllToken
+)
+
+// token is a piece of a route pattern as seen by the route tree.
+type token struct {
+	kind  tokenKind
+	value string
+	// constraint is the regexp a constrained param has to match.
+	constraint string
+}
+
+func isParamNameChar(c byte) bool {
+	return strings.IndexByte(`/#?().\<`, c) < 0
+}
+
+// paramEnd returns where the :param starting at i ends in the pattern, including its constraint.
+func paramEnd(pattern string, i int) int {
+	j := i + 1
+	for j < len(pattern) && isParamNameChar(pattern[j]) {
+		j++
+	}
+	if j < len(pattern) && pattern[j] == '<' {
+		if k := strings.IndexByte(pattern[j:], '>'); k >= 0 {
+			j += k + 1
+		}
+	}
+	return j
+}
+
+// tokenize splits a route pattern into the literals, :params and ** wildcards that newRoute understands.
+// If the pattern also contains raw regular expression syntax, exact is false and the tokens only describe
+// the part of the pattern that every matching path has to start with.
+func tokenize(pattern string) (tokens []token, exact bool) {
+	lit := ""
+	flush := func() {
+		if len(lit) > 0 {
+			tokens = append(tokens, token{kind: literalToken, value: lit})
+			lit = ""
+		}
+	}
+
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		switch {
+		case c == ':' && i+1 < len(pattern) && isParamNameChar(pattern[i+1]):
+			j := paramEnd(pattern, i)
+			name, constraint := splitParam(pattern[i+1 : j])
+			flush()
+			if constraint == paramRegexp {
+				constraint = ""
+			}
+			if constraint != "" && !segmentOnly(constraint) || j < len(pattern) && pattern[j] != '/' && pattern[j] != '#' {
+				// the param's value doesn't simply run up to the next slash
+				return tokens, false
+			}
+			tokens = append(tokens, token{paramToken, name, constraint})
+			i = j
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			flush()
+			tokens = append(tokens, token{kind: catchAllToken})
+			i += 2
+		case c == '|':
+			// an alternation can make any part of the pattern optional
+			return nil, false
+		case strings.IndexByte(regexpMeta, c) >= 0:
+			// a quantifier applies to the character in front of it
+			if strings.IndexByte("?*+{", c) >= 0 && len(lit) > 0 {
+				_, size := utf8.DecodeLastRuneInString(lit)
+				lit = lit[:len(lit)-size]
+			}
+			flush()
+			// a parameter or wildcard followed by a regexp may end anywhere
+			if n := len(tokens); n > 0 && tokens[n-1].kind != literalToken {
+				tokens = tokens[:n-1]
+			}
+			return tokens, false
+		default:
+			lit += string(c)
+			i++
+		}
+	}
+	flush()
+
+	return tokens, true
+}
+
+// segmentOnly reports whether the regexp can only match text within a single path segment.
+func segmentOnly(expr string) bool {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return false
+	}
+	return segmentOnlyRegexp(re)
+}
+
+func segmentOnlyRegexp(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if r == '/' || r == '#' || r == '?' {
+				return false
+			}
+		}
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for _, r := range "/#?" {
+				if re.Rune[i] <= r && r <= re.Rune[i+1] {
+					return false
+				}
+			}
+		}
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL, syntax.OpBeginLine, syntax.OpEndLine,
+		syntax.OpBeginText, syntax.OpEndText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return false
+	}
+	for _, sub := range re.Sub {
+		if !segmentOnlyRegexp(sub) {
+			return false
+		}
+	}
+	return true
+}
+
+type nodeKind uint8
+
+const (
+	staticNode nodeKind = iota
+	paramNode
+	catchAllNode
+)
+
+// node is a node of the route tree. Static nodes match their path literally, param nodes match a single
+// path segment and catch-all nodes match any run of characters, just like the regexps built by newRoute.
+type node struct {
+	kind nodeKind
+	// path is the literal of a static node and the constraint of a param node.
+	path string
+	// constraint is the compiled constraint of a param node.
+	constraint *regexp.Regexp
+	children   []*node
+	leaves     []*leaf
+	// first is the lowest registration index of all the routes below this node.
+	first int
+}
+
+// leaf binds a route to the node where its pattern ends.
+type leaf struct {
+	route *route
+	index int
+	// keys names the values captured by the params and wildcards on the way to the leaf.
+	keys []string
+	// exact is false if the route's regexp still has to be checked against the whole path.
+	exact bool
+}
+
+// routeTree indexes routes by their patterns so a request only has to be checked against the routes
+// whose literal parts match its path. The first registered route still wins.
+type routeTree struct {
+	root *node
+	size int
+	// strict stops routes from matching paths with a trailing slash their pattern doesn't have.
+	strict bool
+}
+
+func newRouteTree() *routeTree {
+	return &routeTree{root: &node{}}
+}
+
+// add registers the route after all the routes already in the tree.
+func (t *routeTree) add(r *route) {
+	tokens, exact := tokenize(r.pattern)
+	l := &leaf{route: r, index: t.size, exact: exact}
+	if t.strict && !exact {
+		r.strict = anchoredRegexp(r.expr)
+	}
+	wildcards := 0
+	for _, tok := range tokens {
+		switch tok.kind {
+		case paramToken:
+			l.keys = append(l.keys, tok.value)
+		case catchAllToken:
+			wildcards++
+			l.keys = append(l.keys, "_"+strconv.Itoa(wildcards))
+		}
+	}
+	t.size++
+	t.root.insert(tokens, l)
+}
+
+// lookup returns the first registered route matching the method, host and path, along with its params.
+func (t *routeTree) lookup(method, host, path string) (*route, Params) {
+	s := &search{path: path, host: host, checkHost: true, method: method, limit: t.size, strict: t.strict}
+	t.root.match(s, path)
+	if len(s.found) == 0 {
+		return nil, nil
+	}
+	// every route found after the first one was registered before it
+	f := s.found[len(s.found)-1]
+	return f.route, f.params
+}
+
+// matchAll returns every route matching the path regardless of its method, in registration order.
+// The host of the routes is only taken into account if checkHost is set.
+func (t *routeTree) matchAll(host, path string, checkHost bool) []*route {
+	s := &search{path: path, host: host, checkHost: checkHost, all: true, limit: t.size, strict: t.strict}
+	t.root.match(s, path)
+	sort.Sort(byIndex(s.found))
+	routes := make([]*route, 0, len(s.found))
+	for i, f := range s.found {
+		if i == 0 || s.found[i-1].index != f.index {
+			routes = append(routes, f.route)
+		}
+	}
+	return routes
+}
+
+type found struct {
+	route  *route
+	index  int
+	params Params
+}
+
+type byIndex []found
+
+func (f byIndex) Len() int           { return len(f) }
+func (f byIndex) Less(i, j int) bool { return f[i].index < f[j].index }
+func (f byIndex) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+// search holds the state of a single walk through the tree.
+type search struct {
+	path      string
+	host      string
+	checkHost bool
+	method    string
+	strict    bool
+	// all makes the search collect every route matching the path, whatever its method.
+	all bool
+	// limit is the registration index a route has to beat to be of interest.
+	limit int
+	// vals holds the values captured on the way down to the current node.
+	vals  []string
+	found []found
+}
+
+func (n *node) insert(tokens []token, l *leaf) {
+	if len(tokens) == 0 {
+		n.leaves = append(n.leaves, l)
+		return
+	}
+
+	tok := tokens[0]
+	if tok.kind == literalToken {
+		n.insertStatic(tok.value, tokens[1:], l)
+		return
+	}
+
+	kind := paramNode
+	if tok.kind == catchAllToken {
+		kind = catchAllNode
+	}
+	for _, c := range n.children {
+		if c.kind == kind && c.path == tok.constraint {
+			c.insert(tokens[1:], l)
+			return
+		}
+	}
+	child := &node{kind: kind, path: tok.constraint, first: l.index}
+	if tok.constraint != "" {
+		child.constraint = regexp.MustCompile(`^(?:` + tok.constraint + `)$`)
+	}
+	n.children = append(n.children, child)
+	child.insert(tokens[1:], l)
+}
+
+func (n *node) insertStatic(path string, rest []token, l *leaf) {
+	for _, c := range n.children {
+		if c.kind != staticNode || c.path[0] != path[0] {
+			continue
+		}
+
+		i := 0
+		for i < len(path) && i < len(c.path) && path[i] == c.path[i] {
+			i++
+		}
+		if i < len(c.path) {
+			c.split(i)
+		}
+		if i < len(path) {
+			c.insertStatic(path[i:], rest, l)
+		} else {
+			c.insert(rest, l)
+		}
+		return
+	}
+
+	child := &node{kind: staticNode, path: path, first: l.index}
+	n.children = append(n.children, child)
+	child.insert(rest, l)
+}
+
+// split moves everything past the first i bytes of the node's path into a new child node.
+func (n *node) split(i int) {
+	child := &node{
+		kind:     staticNode,
+		path:     n.path[i:],
+		children: n.children,
+		leaves:   n.leaves,
+		first:    n.first,
+	}
+	n.path = n.path[:i]
+	n.children = []*node{child}
+	n.leaves = nil
+}
+
+// match walks the subtree for the rest of the path left over by the node's parents.
+func (n *node) match(s *search, rest string) {
+	if n.first >= s.limit {
+		return
+	}
+
+	for _, l := range n.leaves {
+		if l.index >= s.limit {
+			break
+		}
+		if params, ok := l.match(s, rest); ok {
+			s.found = append(s.found, found{l.route, l.index, params})
+			if !s.all {
+				s.limit = l.index
+				break
+			}
+		}
+	}
+
+	for _, c := range n.children {
+		switch c.kind {
+		case staticNode:
+			if strings.HasPrefix(rest, c.path) {
+				c.match(s, rest[len(c.path):])
+			}
+		case paramNode:
+			i := strings.IndexAny(rest, "/#?")
+			if i < 0 {
+				i = len(rest)
+			}
+			if c.constraint != nil && c.constraint.MatchString(rest[:i]) || c.constraint == nil && i > 0 {
+				s.vals = append(s.vals, rest[:i])
+				c.match(s, rest[i:])
+				s.vals = s.vals[:len(s.vals)-1]
+			}
+		case catchAllNode:
+			i := strings.IndexAny(rest, "#?")
+			if i < 0 {
+				i = len(rest)
+			}
+			// longest first, like the greedy regexp
+			for {
+				s.vals = append(s.vals, rest[:i])
+				c.match(s, rest[i:])
+				s.vals = s.vals[:len(s.vals)-1]
+				if i == 0 {
+					break
+				}
+				_, size := utf8.DecodeLastRuneInString(rest[:i])
+				i -= size
+			}
+		}
+	}
+}
+
+func (l *leaf) match(s *search, rest string) (Params, bool) {
+	if !s.all && !l.route.MatchMethod(s.method) {
+		return nil, false
+	}
+
+	var params Params
+	if l.exact {
+		// route patterns accept an optional trailing slash unless the tree is strict
+		if rest != "" && (s.strict || rest != "/") {
+			return nil, false
+		}
+		params = make(Params, len(l.keys))
+		for i, key := range l.keys {
+			params[key] = s.vals[i]
+		}
+	} else {
+		re := l.route.regex
+		if s.strict {
+			re = l.route.strict
+		}
+		var ok bool
+		if params, ok = matchRegexp(re, s.path); !ok {
+			return nil, false
+		}
+	}
+
+	if s.checkHost && l.route.host != nil {
+		hostParams, ok := l.route.host.Match(s.host)
+		if !ok {
+			return nil, false
+		}
+		for k, v := range hostParams {
+			if _, ok := params[k]; !ok {
+				params[k] = v
+			}
+		}
+	}
+	return params, true
+}
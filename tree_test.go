@@ -0,0 +1,251 @@
+package martini
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var treePatterns = []string{
+	"/foo",
+	"/foo/:bar/bat/:baz",
+	"/foo/:bar",
+	"/fez/**",
+	"/pop/**/bap/:id/**",
+	"/wap/**/pow",
+	"/baz/:id/(?P<name>[a-z]*)",
+	"/files/:name.json",
+	"/colou?r",
+	"/a|/b",
+	"/users/:id/",
+	"/users/new",
+	"/items/:id<int>",
+	"/items/:id<uint>/parts",
+	"/items/:slug<[a-z-]+>",
+	"/items/:any<.+>/all",
+	"/tags/:tag<[a-z]*>/x",
+	"/ver/:v<int>.json",
+	"",
+}
+
+var treePaths = []string{
+	"/", "", "/foo", "/foo/", "/foo//", "foo", "/foo/123", "/foo/123/bat/321", "/foo/123/bat/321/",
+	"/foo/123//bat/321/", "/fez", "/fez/", "/fez/this/should/match", "/pop/blah/blah/blah/bap/foo/",
+	"/wap//pow", "/wap/x/y/pow/", "/baz/5/john", "/baz/5/JOHN", "/files/report.json", "/files/reportxjson",
+	"/color", "/colour", "/colouur", "/a", "/b", "/users/7", "/users/7/", "/users/new", "/users/new/",
+	"/foo/héllo", "/fez/éé", "/foo/a?b", "/items/12", "/items/-12", "/items/-12/parts", "/items/12/parts",
+	"/items/my-item", "/items/MyItem", "/items/a/b/all", "/tags//x", "/tags/go/x", "/ver/3.json", "/ver/x.json",
+}
+
+func Test_RouteTree_MatchesRegexp(t *testing.T) {
+	routes := make([]*route, len(treePatterns))
+	tree := newRouteTree()
+	for i, pattern := range treePatterns {
+		routes[i] = newRoute("GET", pattern, nil)
+		tree.add(routes[i])
+	}
+
+	for _, path := range treePaths {
+		var want *route
+		var wantParams map[string]string
+		for _, r := range routes {
+			if ok, params := r.Match("GET", path); ok {
+				want, wantParams = r, params
+				break
+			}
+		}
+
+		got, gotParams := tree.lookup("GET", "", path)
+		if got != want {
+			t.Errorf("%q: expected route %v - got %v", path, want, got)
+			continue
+		}
+		if want != nil && !reflect.DeepEqual(map[string]string(gotParams), wantParams) {
+			t.Errorf("%q: expected params %v - got %v", path, wantParams, gotParams)
+		}
+	}
+}
+
+func Test_RouteTree_FirstRegisteredWins(t *testing.T) {
+	tree := newRouteTree()
+	catchAll := newRoute("GET", "/**", nil)
+	param := newRoute("GET", "/:name", nil)
+	static := newRoute("GET", "/foo", nil)
+	tree.add(catchAll)
+	tree.add(param)
+	tree.add(static)
+
+	r, params := tree.lookup("GET", "", "/foo")
+	expect(t, r, catchAll)
+	expect(t, params["_1"], "foo")
+
+	r, _ = tree.lookup("POST", "", "/foo")
+	expect(t, r, (*route)(nil))
+	expect(t, len(tree.matchAll("", "/foo", false)), 3)
+}
+
+func Test_RouteTree_EarlierRouteInLaterBranch(t *testing.T) {
+	for _, tt := range []struct {
+		first, second, path string
+	}{
+		{"/files/**", "/files/", "/files/"},
+		{"/:x", "/c?", "/c"},
+	} {
+		tree := newRouteTree()
+		first, second := newRoute("GET", tt.first, nil), newRoute("GET", tt.second, nil)
+		tree.add(first)
+		tree.add(second)
+
+		ok, _ := second.Match("GET", tt.path)
+		expect(t, ok, true)
+		r, _ := tree.lookup("GET", "", tt.path)
+		expect(t, r, first)
+	}
+}
+
+func Test_RouteTree_RandomRoutes(t *testing.T) {
+	segments := []string{"a", "b", "c", "c?", "files", ":x", ":id<int>", ":alt<a|ab>", ":v<b|bc>c", "ab", "**", "1", ""}
+	random := rand.New(rand.NewSource(1))
+	join := func(n int) string {
+		path := ""
+		for i := 0; i < n; i++ {
+			path += "/" + segments[random.Intn(len(segments))]
+		}
+		if random.Intn(3) == 0 {
+			path += "/"
+		}
+		return path
+	}
+
+	for set := 0; set < 3000; set++ {
+		tree := newRouteTree()
+		routes := make([]*route, 1+random.Intn(6))
+		for i := range routes {
+			routes[i] = newRoute("GET", join(1+random.Intn(3)), nil)
+			tree.add(routes[i])
+		}
+
+		for p := 0; p < 5; p++ {
+			path := strings.Replace(strings.Replace(join(1+random.Intn(3)), "?", "", -1), "**", "x/y", -1)
+			path = strings.Replace(strings.Replace(path, ":alt<a|ab>", "ab", -1), ":v<b|bc>c", "bcc", -1)
+			path = strings.Replace(strings.Replace(path, ":x", "v", -1), ":id<int>", "42", -1)
+			var want *route
+			var wantParams map[string]string
+			for _, r := range routes {
+				if ok, params := r.Match("GET", path); ok {
+					want, wantParams = r, params
+					break
+				}
+			}
+			got, gotParams := tree.lookup("GET", "", path)
+			if got != want {
+				t.Fatalf("%v on %q: expected route %v - got %v", routes, path, want, got)
+			}
+			if want != nil && !reflect.DeepEqual(map[string]string(gotParams), wantParams) {
+				t.Fatalf("%v on %q: expected params %v - got %v", routes, path, wantParams, gotParams)
+			}
+		}
+	}
+}
+
+func Test_RouteTree_Methods(t *testing.T) {
+	tree := newRouteTree()
+	get := newRoute("GET", "/foo", nil)
+	any := newRoute("*", "/foo", nil)
+	tree.add(get)
+	tree.add(any)
+
+	r, _ := tree.lookup("HEAD", "", "/foo")
+	expect(t, r, get)
+	r, _ = tree.lookup("DELETE", "", "/foo")
+	expect(t, r, any)
+}
+
+func Test_Tokenize(t *testing.T) {
+	exacts := map[string]bool{
+		"/foo/:bar/**":          true,
+		"/items/:id<int>/parts": true,
+		"/items/:slug<[a-z-]+>": true,
+		"/items/:any<.+>":       false,
+		"/ver/:v<int>.json":     false,
+		"/colou?r":              false,
+		"/a|/b":                 false,
+	}
+	for pattern, exact := range exacts {
+		if _, ok := tokenize(pattern); ok != exact {
+			t.Errorf("%q: expected exact to be %v", pattern, exact)
+		}
+	}
+
+	tokens, _ := tokenize("/colou?r")
+	expect(t, len(tokens), 1)
+	expect(t, tokens[0].value, "/colo")
+
+	tokens, _ = tokenize("/a|/b")
+	expect(t, len(tokens), 0)
+}
+
+func benchmarkRouter(n int) (*router, []*http.Request) {
+	r := NewRouter().(*router)
+	var reqs []*http.Request
+	for i := 0; i < n; i++ {
+		r.Get(fmt.Sprintf("/api/v1/resource%d", i), func() {})
+		r.Get(fmt.Sprintf("/api/v1/resource%d/:id", i), func() {})
+		r.Put(fmt.Sprintf("/api/v1/resource%d/:id/items/**", i), func() {})
+	}
+	for _, path := range []string{"/api/v1/resource%d", "/api/v1/resource%d/42", "/api/v1/resource%d/42/items/a/b"} {
+		req, _ := http.NewRequest("GET", fmt.Sprintf(path, n-1), nil)
+		reqs = append(reqs, req)
+	}
+	return r, reqs
+}
+
+func benchmarkTree(b *testing.B, n int) {
+	router, reqs := benchmarkRouter(n)
+	tree := router.tree
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, req := range reqs {
+			tree.lookup(req.Method, req.Host, req.URL.Path)
+		}
+	}
+}
+
+// benchmarkRegexp measures the linear regexp scan the router used before the route tree.
+func benchmarkRegexp(b *testing.B, n int) {
+	router, reqs := benchmarkRouter(n)
+	routes := router.routes
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, req := range reqs {
+			for _, r := range routes {
+				if ok, _ := r.Match(req.Method, req.URL.Path); ok {
+					break
+				}
+			}
+		}
+	}
+}
+
+func Benchmark_RouteTree_10(b *testing.B)     { benchmarkTree(b, 10) }
+func Benchmark_RouteTree_100(b *testing.B)    { benchmarkTree(b, 100) }
+func Benchmark_RouteTree_1000(b *testing.B)   { benchmarkTree(b, 1000) }
+func Benchmark_RouteRegexp_10(b *testing.B)   { benchmarkRegexp(b, 10) }
+func Benchmark_RouteRegexp_100(b *testing.B)  { benchmarkRegexp(b, 100) }
+func Benchmark_RouteRegexp_1000(b *testing.B) { benchmarkRegexp(b, 1000) }
+
+func Benchmark_Router_Handle(b *testing.B) {
+	router, reqs := benchmarkRouter(100)
+	m := New()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, req := range reqs {
+			recorder := httptest.NewRecorder()
+			router.Handle(recorder, req, m.createContext(recorder, req))
+		}
+	}
+}
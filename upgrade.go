@@ -0,0 +1,139 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package martini
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// upgradeFdsEnv tells a process started by an upgrade how many listeners it inherited. They are passed as the
+// file descriptors after stderr, followed by a pipe the new process closes once it serves them.
+const upgradeFdsEnv = "MARTINI_UPGRADE_FDS"
+
+var upgradeSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR2}
+
+// Upgrade starts the executable again with the same arguments and hands it the listeners of the server started
+// by RunWithOptions with the Upgrade option. Once the new process serves them, this server shuts down gracefully
+// and RunWithOptions returns. If the new process fails to start, this server keeps serving.
+func (m *Martini) Upgrade() error {
+	m.mu.Lock()
+	state := m.state
+	m.mu.Unlock()
+	if state == nil || !state.opt.Upgrade {
+		return errors.New("martini: no server with the Upgrade option is running")
+	}
+
+	if err := startUpgrade(state.listeners, state.opt.UpgradeTimeout); err != nil {
+		return err
+	}
+
+	for _, ln := range state.listeners {
+		// the socket file belongs to the new process now
+		if ln, ok := ln.(*net.UnixListener); ok {
+			ln.SetUnlinkOnClose(false)
+		}
+	}
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), state.opt.ShutdownTimeout)
+	defer cancel()
+	return m.Shutdown(ctx)
+}
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// startUpgrade starts the new process and waits until it serves the listeners.
+func startUpgrade(listeners []net.Listener, timeout time.Duration) error {
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, ln := range listeners {
+		l, ok := ln.(filer)
+		if !ok {
+			return fmt.Errorf("martini: can't hand over the listener on %s", ln.Addr())
+		}
+		f, err := l.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	ready, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	files = append(files, w)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), upgradeFdsEnv+"="+strconv.Itoa(len(listeners)))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// only the new process holds the write end now, reading fails if it exits
+	w.Close()
+	files = files[:len(files)-1]
+
+	readc := make(chan error, 1)
+	go func() {
+		_, err := ready.Read(make([]byte, 1))
+		readc <- err
+	}()
+	select {
+	case err := <-readc:
+		if err != nil {
+			cmd.Wait()
+			return errors.New("martini: the new process exited before it served the listeners")
+		}
+		cmd.Process.Release()
+		return nil
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return errors.New("martini: the new process didn't serve the listeners within " + timeout.String())
+	}
+}
+
+// upgradeListeners returns the listeners handed over by the process that started this one with an upgrade,
+// along with the pipe to close when they are served. It returns nil if this process wasn't started that way.
+func upgradeListeners() ([]net.Listener, *os.File, error) {
+	n, err := strconv.Atoi(os.Getenv(upgradeFdsEnv))
+	if err != nil || n <= 0 {
+		return nil, nil, nil
+	}
+	os.Unsetenv(upgradeFdsEnv)
+
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		f := os.NewFile(uintptr(listenFdsStart+i), "listener")
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil, nil, fmt.Errorf("martini: inherited listener %d: %v", i, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, os.NewFile(uintptr(listenFdsStart+n), "upgrade"), nil
+}
@@ -0,0 +1,21 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package martini
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+var upgradeSignals []os.Signal
+
+// Upgrade isn't supported on this platform and always returns an error.
+func (m *Martini) Upgrade() error {
+	return errors.New("martini: upgrades aren't supported on this platform")
+}
+
+func upgradeListeners() ([]net.Listener, *os.File, error) {
+	return nil, nil, nil
+}
@@ -0,0 +1,81 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package martini
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Test_Upgrade hands its listener to a copy of the test binary, which runs the child branch of the test.
+func Test_Upgrade(t *testing.T) {
+	if os.Getenv(upgradeFdsEnv) != "" {
+		m := New()
+		m.Map(log.New(ioutil.Discard, "", 0))
+		m.Action(func(res http.ResponseWriter) {
+			res.Write([]byte(strconv.Itoa(os.Getpid())))
+		})
+		if err := m.RunWithOptions(RunOptions{Upgrade: true}); err != nil {
+			os.Exit(1)
+		}
+		// don't let the child report test results
+		os.Exit(0)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	expect(t, err, nil)
+	url := "http://" + ln.Addr().String()
+
+	m := New()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Action(func(res http.ResponseWriter) {
+		res.Write([]byte(strconv.Itoa(os.Getpid())))
+	})
+	started := make(chan struct{})
+	m.OnStart(func() {
+		close(started)
+	})
+
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^Test_Upgrade$"}
+	defer func() {
+		os.Args = args
+	}()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- m.RunWithOptions(RunOptions{Listener: ln, Upgrade: true, DisableSignals: true, UpgradeTimeout: 10 * time.Second})
+	}()
+	<-started
+	expect(t, getBody(t, url), strconv.Itoa(os.Getpid()))
+
+	expect(t, m.Upgrade(), nil)
+	expect(t, <-errc, nil)
+
+	// the child serves the same address now
+	pid, err := strconv.Atoi(getBody(t, url))
+	expect(t, err, nil)
+	refute(t, pid, os.Getpid())
+	expect(t, syscall.Kill(pid, syscall.SIGTERM), nil)
+
+	expect(t, m.Upgrade() != nil, true)
+}
+
+func getBody(t *testing.T, url string) string {
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	return string(body)
+}
@@ -0,0 +1,264 @@
+package martini
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// UploadsOptions is a struct for specifying configuration options for the martini.Uploads middleware.
+type UploadsOptions struct {
+	// MaxSize is the size of the largest request body, files and values together. Defaults to 32 MB.
+	MaxSize int64
+	// MaxFileSize is the size of the largest file. Defaults to MaxSize.
+	MaxFileSize int64
+	// AllowedTypes are the media types files may have, like "application/pdf" or "image/*". The type is
+	// sniffed from the content with http.DetectContentType. Defaults to allowing any type.
+	AllowedTypes []string
+	// TempDir is the directory the files are spooled to. Defaults to os.TempDir().
+	TempDir string
+}
+
+func prepareUploadsOptions(options []UploadsOptions) UploadsOptions {
+	var opt UploadsOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	// Defaults
+	if opt.MaxSize == 0 {
+		opt.MaxSize = defaultMaxMemory
+	}
+	if opt.MaxFileSize == 0 || opt.MaxFileSize > opt.MaxSize {
+		opt.MaxFileSize = opt.MaxSize
+	}
+	return opt
+}
+
+// UploadedFile is a file of a multipart request, spooled to a temporary file that is removed after the
+// request unless it is saved.
+type UploadedFile struct {
+	// Field is the name of the form field the file was sent in.
+	Field string
+	// Filename is the name the client gave the file, without its directory.
+	Filename string
+	// ContentType is the sniffed media type of the file.
+	ContentType string
+	Size        int64
+	// Path is the temporary file, or where it was saved.
+	Path string
+
+	tmp string
+}
+
+// Open opens the temporary file for reading.
+func (f *UploadedFile) Open() (*os.File, error) {
+	return os.Open(f.Path)
+}
+
+// Save moves the file to the path, so it isn't removed after the request.
+func (f *UploadedFile) Save(path string) error {
+	if err := os.Rename(f.Path, path); err == nil {
+		f.Path = path
+		return nil
+	}
+
+	// the path is on another device
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	os.Remove(f.Path)
+	f.Path = path
+	return nil
+}
+
+// UploadedFiles is the service the Uploads middleware maps. It holds the files and the values of the request,
+// which are empty if the request isn't a multipart form.
+type UploadedFiles struct {
+	Files  []*UploadedFile
+	Values url.Values
+}
+
+// File returns the first file sent in the field, or nil.
+func (u *UploadedFiles) File(field string) *UploadedFile {
+	for _, f := range u.Files {
+		if f.Field == field {
+			return f
+		}
+	}
+	return nil
+}
+
+// Field returns the files sent in the field.
+func (u *UploadedFiles) Field(field string) []*UploadedFile {
+	var files []*UploadedFile
+	for _, f := range u.Files {
+		if f.Field == field {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Uploads returns a middleware handler that reads multipart forms and maps an *UploadedFiles. The files are
+// spooled to temporary files while the request is read, and removed once the handlers after Uploads return.
+// The form values are available from the *http.Request as well.
+//
+// Requests larger than MaxSize, or with a file larger than MaxFileSize, are answered with 413, files of other
+// than the AllowedTypes with 415, through the ErrorHandler.
+//
+//	m.Post("/avatars", martini.Uploads(martini.UploadsOptions{
+//		MaxFileSize:  2 << 20,
+//		AllowedTypes: []string{"image/png", "image/jpeg"},
+//	}), func(u *martini.UploadedFiles) error {
+//		return u.File("avatar").Save(filepath.Join("avatars", u.Values.Get("user")))
+//	})
+func Uploads(options ...UploadsOptions) Handler {
+	opt := prepareUploadsOptions(options)
+	return func(c Context, res http.ResponseWriter, req *http.Request) {
+		uploads := &UploadedFiles{Values: url.Values{}}
+		defer uploads.removeAll()
+
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get(ContentType))
+		if mediaType == "multipart/form-data" {
+			req.Body = http.MaxBytesReader(res, req.Body, opt.MaxSize)
+			if err := uploads.read(req, opt); err != nil {
+				handleError(c, err)
+				return
+			}
+			req.MultipartForm = &multipart.Form{Value: uploads.Values, File: map[string][]*multipart.FileHeader{}}
+			req.PostForm = uploads.Values
+			req.Form = req.URL.Query()
+			for k, v := range uploads.Values {
+				req.Form[k] = append(req.Form[k], v...)
+			}
+		}
+
+		c.Map(uploads)
+		c.Next()
+	}
+}
+
+// read reads the parts of the multipart request.
+func (u *UploadedFiles) read(req *http.Request, opt UploadsOptions) error {
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return uploadError(err)
+		}
+
+		if part.FileName() == "" {
+			value, err := ioutil.ReadAll(part)
+			if err != nil {
+				return uploadError(err)
+			}
+			u.Values.Add(part.FormName(), string(value))
+		} else if err := u.spool(part, opt); err != nil {
+			return err
+		}
+		part.Close()
+	}
+}
+
+// spool copies the file of the part to a temporary file.
+func (u *UploadedFiles) spool(part *multipart.Part, opt UploadsOptions) error {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return uploadError(err)
+	}
+	head = head[:n]
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !allowedType(contentType, opt.AllowedTypes) {
+		return NewHTTPError(http.StatusUnsupportedMediaType, part.FileName()+" is a "+contentType+", which isn't allowed")
+	}
+
+	tmp, err := ioutil.TempFile(opt.TempDir, "martini-upload-")
+	if err != nil {
+		return err
+	}
+	f := &UploadedFile{
+		Field:       part.FormName(),
+		Filename:    filepath.Base(filepath.FromSlash(part.FileName())),
+		ContentType: contentType,
+		Path:        tmp.Name(),
+		tmp:         tmp.Name(),
+	}
+	u.Files = append(u.Files, f)
+
+	// copy one byte more than allowed to find out if the file is too large
+	f.Size, err = io.Copy(tmp, io.MultiReader(bytes.NewReader(head), io.LimitReader(part, opt.MaxFileSize-int64(n)+1)))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return uploadError(err)
+	}
+	if f.Size > opt.MaxFileSize {
+		return NewHTTPError(http.StatusRequestEntityTooLarge,
+			part.FileName()+" is larger than "+strconv.FormatInt(opt.MaxFileSize, 10)+" bytes")
+	}
+	return nil
+}
+
+func (u *UploadedFiles) removeAll() {
+	for _, f := range u.Files {
+		// saved files aren't there anymore
+		os.Remove(f.tmp)
+	}
+}
+
+// uploadError turns the error of reading the request into an HTTPError.
+func uploadError(err error) error {
+	var httpErr HTTPError
+	if errors.As(err, &httpErr) {
+		// from BodyLimit
+		return httpErr
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return NewHTTPError(http.StatusRequestEntityTooLarge, "the request is larger than "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+	}
+	return NewHTTPError(http.StatusBadRequest, "the multipart form is invalid: "+err.Error())
+}
+
+// allowedType reports whether the media type matches one of the allowed ones, or if any type is allowed.
+func allowedType(mediaType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if matchMediaType(a, mediaType) >= 0 {
+			return true
+		}
+	}
+	return false
+}
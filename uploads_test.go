@@ -0,0 +1,122 @@
+package martini
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\x0D\x0A\x1A\x0A")
+
+// png returns a file that is sniffed as a PNG, with n bytes after the header.
+func png(n int) []byte {
+	return append(append([]byte(nil), pngHeader...), make([]byte, n)...)
+}
+
+func multipartRequest(t *testing.T, values map[string]string, files map[string][]byte) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range values {
+		w.WriteField(k, v)
+	}
+	for name, content := range files {
+		f, err := w.CreateFormFile(strings.Split(name, "/")[0], name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(content)
+	}
+	w.Close()
+	req, _ := http.NewRequest("POST", "/upload?source=test", &body)
+	req.Header.Set(ContentType, w.FormDataContentType())
+	return req
+}
+
+func Test_Uploads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "martini-uploads")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	var spooled []string
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Post("/upload", Uploads(UploadsOptions{TempDir: dir, AllowedTypes: []string{"image/png", "text/*"}}),
+		func(u *UploadedFiles, req *http.Request) error {
+			expect(t, u.Values.Get("title"), "holiday")
+			expect(t, req.FormValue("title"), "holiday")
+			expect(t, req.FormValue("source"), "test")
+			expect(t, len(u.Files), 2)
+
+			photo := u.File("photo")
+			expect(t, photo.Filename, "beach.png")
+			expect(t, photo.ContentType, "image/png")
+			expect(t, photo.Size, int64(len(pngHeader)+4))
+			expect(t, filepath.Dir(photo.Path), dir)
+
+			notes := u.Field("notes")
+			expect(t, len(notes), 1)
+			expect(t, notes[0].ContentType, "text/plain")
+			f, err := notes[0].Open()
+			expect(t, err, nil)
+			content, _ := ioutil.ReadAll(f)
+			f.Close()
+			expect(t, string(content), "remember sunscreen")
+
+			spooled = append(spooled, photo.Path, notes[0].Path)
+			return photo.Save(filepath.Join(dir, "saved.png"))
+		})
+
+	res := httptest.NewRecorder()
+	m.ServeHTTP(res, multipartRequest(t, map[string]string{"title": "holiday"}, map[string][]byte{
+		"photo/beach.png": append(append([]byte(nil), pngHeader...), "data"...),
+		"notes":           []byte("remember sunscreen"),
+	}))
+	expect(t, res.Code, http.StatusOK)
+
+	// the saved file stays, the other one is removed
+	_, err = os.Stat(filepath.Join(dir, "saved.png"))
+	expect(t, err, nil)
+	for _, path := range spooled {
+		_, err = os.Stat(path)
+		expect(t, os.IsNotExist(err), true)
+	}
+}
+
+func Test_UploadsLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "martini-uploads")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Post("/upload", Uploads(UploadsOptions{MaxSize: 4096, MaxFileSize: 1024, AllowedTypes: []string{"image/png"}, TempDir: dir}),
+		func() string {
+			return "uploaded"
+		})
+
+	for _, tt := range []struct {
+		files map[string][]byte
+		code  int
+	}{
+		{map[string][]byte{"a.png": png(1000)}, http.StatusOK},
+		{map[string][]byte{"a.png": png(1024)}, http.StatusRequestEntityTooLarge},
+		{map[string][]byte{"a.png": png(1000), "b.png": png(1000), "c.png": png(1000), "d.png": png(1000), "e.png": png(1000)},
+			http.StatusRequestEntityTooLarge},
+		{map[string][]byte{"a.txt": []byte("plain text")}, http.StatusUnsupportedMediaType},
+	} {
+		res := httptest.NewRecorder()
+		m.ServeHTTP(res, multipartRequest(t, nil, tt.files))
+		expect(t, res.Code, tt.code)
+	}
+
+	// nothing is left behind
+	left, _ := ioutil.ReadDir(dir)
+	expect(t, len(left), 0)
+}
@@ -0,0 +1,539 @@
+package martini
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The message types of ReadMessage and WriteMessage.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+)
+
+// The opcodes of the WebSocket frames, RFC 6455 section 5.2.
+const (
+	opContinuation = 0
+	opText         = 1
+	opBinary       = 2
+	opClose        = 8
+	opPing         = 9
+	opPong         = 10
+)
+
+// webSocketGUID is appended to the key of the handshake, RFC 6455 section 1.3.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// CloseCode is the status code of a WebSocket close frame, RFC 6455 section 7.4.
+type CloseCode int
+
+const (
+	CloseNormal          CloseCode = 1000
+	CloseGoingAway       CloseCode = 1001
+	CloseProtocolError   CloseCode = 1002
+	CloseUnsupportedData CloseCode = 1003
+	CloseNoStatus        CloseCode = 1005
+	CloseAbnormal        CloseCode = 1006
+	CloseInvalidData     CloseCode = 1007
+	ClosePolicyViolation CloseCode = 1008
+	CloseMessageTooBig   CloseCode = 1009
+	CloseInternalError   CloseCode = 1011
+)
+
+// valid reports whether the code may be sent in a close frame.
+func (code CloseCode) valid() bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011, code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// CloseError is returned by ReadMessage once the connection is closed, by the client or because it broke the
+// protocol.
+type CloseError struct {
+	Code CloseCode
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("websocket: closed with %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: closed with %d: %s", e.Code, e.Text)
+}
+
+// ErrWebSocketClosed is returned when writing to a WebSocket connection after it was closed.
+var ErrWebSocketClosed = errors.New("websocket: the connection is closed")
+
+// WebSocketOptions is a struct for specifying configuration options for the martini.WebSocket middleware.
+type WebSocketOptions struct {
+	// CheckOrigin decides whether the request may upgrade, given its Origin header. Defaults to allowing
+	// requests without an Origin header and the ones from the host they are sent to.
+	CheckOrigin func(*http.Request) bool
+	// Subprotocols the server supports, in the order it prefers them.
+	Subprotocols []string
+	// MaxMessageSize is the size of the largest message that is read. The connection is closed with
+	// CloseMessageTooBig when a client sends a larger one. Defaults to 1 MB.
+	MaxMessageSize int64
+	// FragmentSize splits written messages into frames of at most that many bytes, if set.
+	FragmentSize int
+	// CloseTimeout is how long to wait for the client to answer a close frame. Defaults to 5 seconds.
+	CloseTimeout time.Duration
+}
+
+func prepareWebSocketOptions(options []WebSocketOptions) WebSocketOptions {
+	var opt WebSocketOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	// Defaults
+	if opt.CheckOrigin == nil {
+		opt.CheckOrigin = sameOrigin
+	}
+	if opt.MaxMessageSize == 0 {
+		opt.MaxMessageSize = 1 << 20
+	}
+	if opt.CloseTimeout == 0 {
+		opt.CloseTimeout = 5 * time.Second
+	}
+	return opt
+}
+
+// sameOrigin allows requests without an Origin header and the ones from the host they are sent to.
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, req.Host)
+}
+
+// WebSocket returns a middleware handler that upgrades the request to a WebSocket connection and maps a
+// *WebSocketConn for the handlers after it. Requests that aren't a valid handshake are answered with 400,
+// the ones from a forbidden origin with 403. The connection is closed when the handlers return.
+//
+//	m.Get("/echo", martini.WebSocket(), func(ws *martini.WebSocketConn) {
+//		for {
+//			typ, msg, err := ws.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			ws.WriteMessage(typ, msg)
+//		}
+//	})
+func WebSocket(options ...WebSocketOptions) Handler {
+	opt := prepareWebSocketOptions(options)
+	return func(c Context, res http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" || !headerContains(req.Header, "Connection", "upgrade") ||
+			!headerContains(req.Header, "Upgrade", "websocket") {
+			http.Error(res, "websocket: not a websocket handshake", http.StatusBadRequest)
+			return
+		}
+		if req.Header.Get("Sec-WebSocket-Version") != "13" {
+			res.Header().Set("Sec-WebSocket-Version", "13")
+			http.Error(res, "websocket: unsupported version", http.StatusUpgradeRequired)
+			return
+		}
+		key := req.Header.Get("Sec-WebSocket-Key")
+		if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+			http.Error(res, "websocket: invalid Sec-WebSocket-Key", http.StatusBadRequest)
+			return
+		}
+		if !opt.CheckOrigin(req) {
+			http.Error(res, "websocket: origin not allowed", http.StatusForbidden)
+			return
+		}
+		subprotocol := selectSubprotocol(req, opt.Subprotocols)
+
+		hijacker, ok := res.(http.Hijacker)
+		if !ok {
+			http.Error(res, "websocket: the ResponseWriter doesn't support the Hijacker interface", http.StatusInternalServerError)
+			return
+		}
+		conn, brw, err := hijacker.Hijack()
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the server's timeouts don't apply to the connection anymore
+		conn.SetDeadline(time.Time{})
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		brw.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+		if subprotocol != "" {
+			brw.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+		}
+		brw.WriteString("\r\n")
+		if err := brw.Flush(); err != nil {
+			conn.Close()
+			return
+		}
+
+		ws := newWebSocketConn(conn, brw.Reader, true, opt)
+		ws.subprotocol = subprotocol
+		c.Map(ws)
+		defer ws.finish()
+		c.Next()
+	}
+}
+
+// headerContains reports whether the comma separated values of the header contain the token.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectSubprotocol returns the first of the supported subprotocols the client asked for.
+func selectSubprotocol(req *http.Request, supported []string) string {
+	for _, s := range supported {
+		if headerContains(req.Header, "Sec-WebSocket-Protocol", s) {
+			return s
+		}
+	}
+	return ""
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+webSocketGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// WebSocketConn is a WebSocket connection. It is mapped by the WebSocket middleware. One goroutine may read
+// from it at a time, writing is safe from several goroutines.
+type WebSocketConn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	server      bool
+	opt         WebSocketOptions
+	subprotocol string
+	pongHandler func([]byte)
+
+	// closeErr is set once the client's close frame was read
+	closeErr *CloseError
+
+	mu        sync.Mutex
+	closeSent bool
+}
+
+func newWebSocketConn(conn net.Conn, br *bufio.Reader, server bool, opt WebSocketOptions) *WebSocketConn {
+	return &WebSocketConn{conn: conn, br: br, server: server, opt: opt}
+}
+
+// Subprotocol returns the subprotocol agreed on in the handshake, or "".
+func (ws *WebSocketConn) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// RemoteAddr returns the address of the client.
+func (ws *WebSocketConn) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline of ReadMessage, see net.Conn.
+func (ws *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of the writes, see net.Conn.
+func (ws *WebSocketConn) SetWriteDeadline(t time.Time) error {
+	return ws.conn.SetWriteDeadline(t)
+}
+
+// SetPongHandler sets a func that is called with the data of the pong frames ReadMessage reads.
+func (ws *WebSocketConn) SetPongHandler(h func(data []byte)) {
+	ws.pongHandler = h
+}
+
+// ReadMessage reads the next text or binary message, joining its fragments. Pings are answered while reading.
+// Once the client closes the connection, or breaks the protocol, it returns a *CloseError.
+func (ws *WebSocketConn) ReadMessage() (messageType int, p []byte, err error) {
+	if ws.closeErr != nil {
+		return 0, nil, ws.closeErr
+	}
+	for {
+		fin, opcode, payload, err := ws.readFrame(int64(len(p)))
+		if err != nil {
+			return 0, nil, ws.fail(err)
+		}
+
+		switch opcode {
+		case opPing:
+			if err := ws.writeControl(opPong, payload); err != nil && err != ErrWebSocketClosed {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			if ws.pongHandler != nil {
+				ws.pongHandler(payload)
+			}
+			continue
+		case opClose:
+			return 0, nil, ws.closed(payload)
+		case opContinuation:
+			if messageType == 0 {
+				return 0, nil, ws.fail(&CloseError{CloseProtocolError, "continuation frame without a message"})
+			}
+		case opText, opBinary:
+			if messageType != 0 {
+				return 0, nil, ws.fail(&CloseError{CloseProtocolError, "new message before the last one ended"})
+			}
+			messageType = int(opcode)
+		default:
+			return 0, nil, ws.fail(&CloseError{CloseProtocolError, fmt.Sprintf("unknown opcode %d", opcode)})
+		}
+
+		p = append(p, payload...)
+		if fin {
+			if messageType == TextMessage && !utf8.Valid(p) {
+				return 0, nil, ws.fail(&CloseError{CloseInvalidData, "text message isn't valid UTF-8"})
+			}
+			return messageType, p, nil
+		}
+	}
+}
+
+// readFrame reads the next frame. read is the size of the fragments of the message read so far.
+func (ws *WebSocketConn) readFrame(read int64) (fin bool, opcode byte, payload []byte, err error) {
+	var h [2]byte
+	if _, err := io.ReadFull(ws.br, h[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = h[0]&0x80 != 0, h[0]&0x0f
+	if h[0]&0x70 != 0 {
+		return false, 0, nil, &CloseError{CloseProtocolError, "reserved bits are set"}
+	}
+	masked := h[1]&0x80 != 0
+	if masked != ws.server {
+		return false, 0, nil, &CloseError{CloseProtocolError, "frames from clients must be masked, the others not"}
+	}
+
+	n := int64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(ws.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = int64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(ws.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		if b[0]&0x80 != 0 {
+			return false, 0, nil, &CloseError{CloseProtocolError, "invalid payload length"}
+		}
+		n = int64(binary.BigEndian.Uint64(b[:]))
+	}
+	if opcode >= opClose {
+		if !fin || n > 125 {
+			return false, 0, nil, &CloseError{CloseProtocolError, "invalid control frame"}
+		}
+	} else if n > ws.opt.MaxMessageSize-read {
+		return false, 0, nil, &CloseError{CloseMessageTooBig, fmt.Sprintf("message is larger than %d bytes", ws.opt.MaxMessageSize)}
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.br, key[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(ws.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(key, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+// closed answers the client's close frame and closes the connection.
+func (ws *WebSocketConn) closed(payload []byte) error {
+	ce := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		return ws.fail(&CloseError{CloseProtocolError, "invalid close frame"})
+	case len(payload) >= 2:
+		ce.Code = CloseCode(binary.BigEndian.Uint16(payload))
+		ce.Text = string(payload[2:])
+		if !ce.Code.valid() {
+			return ws.fail(&CloseError{CloseProtocolError, fmt.Sprintf("invalid close code %d", ce.Code)})
+		}
+		if !utf8.ValidString(ce.Text) {
+			return ws.fail(&CloseError{CloseInvalidData, "close reason isn't valid UTF-8"})
+		}
+	}
+	// echo the code, RFC 6455 section 5.5.1
+	if len(payload) > 2 {
+		payload = payload[:2]
+	}
+	ws.writeControl(opClose, payload)
+	ws.closeErr = ce
+	ws.conn.Close()
+	return ce
+}
+
+// fail closes the connection after a read error. Protocol errors are told to the client first.
+func (ws *WebSocketConn) fail(err error) error {
+	ce, ok := err.(*CloseError)
+	if !ok {
+		ce = &CloseError{Code: CloseAbnormal, Text: err.Error()}
+	} else {
+		ws.CloseWithCode(ce.Code, ce.Text)
+	}
+	ws.closeErr = ce
+	ws.conn.Close()
+	return ce
+}
+
+// WriteMessage writes a text or binary message.
+func (ws *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", messageType)
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+
+	opcode := byte(messageType)
+	for {
+		chunk := data
+		if ws.opt.FragmentSize > 0 && len(chunk) > ws.opt.FragmentSize {
+			chunk = chunk[:ws.opt.FragmentSize]
+		}
+		data = data[len(chunk):]
+		if err := ws.writeFrame(len(data) == 0, opcode, chunk); err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		opcode = opContinuation
+	}
+}
+
+// Ping sends a ping with the data, the client answers it with a pong. The data is at most 125 bytes.
+func (ws *WebSocketConn) Ping(data []byte) error {
+	return ws.writeControl(opPing, data)
+}
+
+// Close starts closing the connection with CloseNormal, see CloseWithCode.
+func (ws *WebSocketConn) Close() error {
+	return ws.CloseWithCode(CloseNormal, "")
+}
+
+// CloseWithCode sends a close frame with the code and reason, nothing can be written afterwards. The client
+// answers it with a close frame of its own, which makes ReadMessage return a *CloseError. The connection is
+// closed at the latest when the handlers return.
+func (ws *WebSocketConn) CloseWithCode(code CloseCode, text string) error {
+	payload := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, text...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	return ws.writeControl(opClose, payload)
+}
+
+func (ws *WebSocketConn) writeControl(opcode byte, payload []byte) error {
+	if len(payload) > 125 {
+		return errors.New("websocket: control frames carry at most 125 bytes")
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+	if opcode == opClose {
+		ws.closeSent = true
+	}
+	return ws.writeFrame(true, opcode, payload)
+}
+
+// writeFrame writes a frame, the caller holds ws.mu.
+func (ws *WebSocketConn) writeFrame(fin bool, opcode byte, payload []byte) error {
+	buf := make([]byte, 0, 14+len(payload))
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	buf = append(buf, b0)
+
+	var mask byte
+	if !ws.server {
+		mask = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, mask|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, mask|126, byte(n>>8), byte(n))
+	default:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		buf = append(append(buf, mask|127), b[:]...)
+	}
+
+	if ws.server {
+		buf = append(buf, payload...)
+	} else {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		buf = append(buf, key[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(key, buf[start:])
+	}
+	_, err := ws.conn.Write(buf)
+	return err
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+// finish closes the connection once the handlers return, giving the client CloseTimeout to answer the close.
+func (ws *WebSocketConn) finish() {
+	if ws.closeErr == nil {
+		if ws.Close() == nil {
+			ws.conn.SetReadDeadline(time.Now().Add(ws.opt.CloseTimeout))
+			for ws.closeErr == nil {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					break
+				}
+			}
+		}
+	}
+	ws.conn.Close()
+}
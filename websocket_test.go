@@ -0,0 +1,160 @@
+package martini
+
+import (
+	"bufio"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// dialWebSocket connects a client to the WebSocket server, reusing the framing of WebSocketConn.
+func dialWebSocket(t *testing.T, url string, header http.Header, opt WebSocketOptions) (*WebSocketConn, *http.Response) {
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	conn, err := net.Dial("tcp", req.URL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, res
+	}
+	expect(t, res.Header.Get("Sec-WebSocket-Accept"), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	return newWebSocketConn(conn, br, false, prepareWebSocketOptions([]WebSocketOptions{opt})), res
+}
+
+func newWebSocketServer(opt WebSocketOptions, handler Handler) *httptest.Server {
+	m := Classic()
+	m.Map(log.New(ioutil.Discard, "", 0))
+	m.Get("/ws", WebSocket(opt), handler)
+	return httptest.NewServer(m)
+}
+
+func echo(ws *WebSocketConn) {
+	for {
+		typ, msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if string(msg) == "bye" {
+			ws.CloseWithCode(CloseGoingAway, "see you")
+		}
+		ws.WriteMessage(typ, msg)
+	}
+}
+
+func Test_WebSocketEcho(t *testing.T) {
+	server := newWebSocketServer(WebSocketOptions{Subprotocols: []string{"chat", "json"}}, echo)
+	defer server.Close()
+
+	ws, res := dialWebSocket(t, server.URL+"/ws", http.Header{"Sec-Websocket-Protocol": {"json, chat"}},
+		WebSocketOptions{FragmentSize: 3})
+	expect(t, res.Header.Get("Sec-WebSocket-Protocol"), "chat")
+
+	expect(t, ws.WriteMessage(TextMessage, []byte("hello world")), nil)
+	typ, msg, err := ws.ReadMessage()
+	expect(t, err, nil)
+	expect(t, typ, TextMessage)
+	expect(t, string(msg), "hello world")
+
+	var pong string
+	ws.SetPongHandler(func(data []byte) {
+		pong = string(data)
+	})
+	expect(t, ws.Ping([]byte("ping")), nil)
+	expect(t, ws.WriteMessage(BinaryMessage, []byte{0, 1, 2, 3, 4}), nil)
+	typ, msg, err = ws.ReadMessage()
+	expect(t, err, nil)
+	expect(t, typ, BinaryMessage)
+	expect(t, string(msg), "\x00\x01\x02\x03\x04")
+	expect(t, pong, "ping")
+
+	expect(t, ws.WriteMessage(TextMessage, []byte("bye")), nil)
+	_, _, err = ws.ReadMessage()
+	ce, ok := err.(*CloseError)
+	expect(t, ok, true)
+	expect(t, ce.Code, CloseGoingAway)
+	expect(t, ce.Text, "see you")
+}
+
+func Test_WebSocketHandlerReturns(t *testing.T) {
+	server := newWebSocketServer(WebSocketOptions{}, func(ws *WebSocketConn) {
+		ws.WriteMessage(TextMessage, []byte("hi"))
+	})
+	defer server.Close()
+
+	ws, _ := dialWebSocket(t, server.URL+"/ws", nil, WebSocketOptions{})
+	_, msg, err := ws.ReadMessage()
+	expect(t, err, nil)
+	expect(t, string(msg), "hi")
+	_, _, err = ws.ReadMessage()
+	expect(t, err.(*CloseError).Code, CloseNormal)
+	expect(t, ws.WriteMessage(TextMessage, []byte("late")), ErrWebSocketClosed)
+}
+
+func Test_WebSocketLimitsAndProtocolErrors(t *testing.T) {
+	server := newWebSocketServer(WebSocketOptions{MaxMessageSize: 8}, echo)
+	defer server.Close()
+
+	ws, _ := dialWebSocket(t, server.URL+"/ws", nil, WebSocketOptions{FragmentSize: 4})
+	expect(t, ws.WriteMessage(TextMessage, []byte("way too long")), nil)
+	_, _, err := ws.ReadMessage()
+	expect(t, err.(*CloseError).Code, CloseMessageTooBig)
+
+	ws, _ = dialWebSocket(t, server.URL+"/ws", nil, WebSocketOptions{})
+	// a fragment of a byte, then a continuation as long as the length can be
+	ws.conn.Write([]byte{0x01, 0x81, 0, 0, 0, 0, 'a'})
+	ws.conn.Write([]byte{0x80, 0xff, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	_, _, err = ws.ReadMessage()
+	expect(t, err.(*CloseError).Code, CloseMessageTooBig)
+
+	ws, _ = dialWebSocket(t, server.URL+"/ws", nil, WebSocketOptions{})
+	// an unmasked frame
+	ws.conn.Write([]byte{0x81, 0x02, 'h', 'i'})
+	_, _, err = ws.ReadMessage()
+	expect(t, err.(*CloseError).Code, CloseProtocolError)
+
+	ws, _ = dialWebSocket(t, server.URL+"/ws", nil, WebSocketOptions{})
+	expect(t, ws.WriteMessage(TextMessage, []byte{0xff, 0xfe}), nil)
+	_, _, err = ws.ReadMessage()
+	expect(t, err.(*CloseError).Code, CloseInvalidData)
+}
+
+func Test_WebSocketHandshake(t *testing.T) {
+	server := newWebSocketServer(WebSocketOptions{}, echo)
+	defer server.Close()
+
+	_, res := dialWebSocket(t, server.URL+"/ws", http.Header{"Origin": {"http://evil.example"}}, WebSocketOptions{})
+	expect(t, res.StatusCode, http.StatusForbidden)
+
+	_, res = dialWebSocket(t, server.URL+"/ws", http.Header{"Sec-Websocket-Version": {"8"}}, WebSocketOptions{})
+	expect(t, res.StatusCode, http.StatusUpgradeRequired)
+	expect(t, res.Header.Get("Sec-WebSocket-Version"), "13")
+
+	ws, _ := dialWebSocket(t, server.URL+"/ws", http.Header{"Origin": {server.URL}}, WebSocketOptions{})
+	expect(t, ws != nil, true)
+	ws.Close()
+
+	res, err := http.Get(server.URL + "/ws")
+	expect(t, err, nil)
+	expect(t, res.StatusCode, http.StatusBadRequest)
+	res.Body.Close()
+}